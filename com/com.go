@@ -1,33 +1,121 @@
 package com
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	readBufferSize        = 1024
 	atSendingQueueTimeout = 500 * time.Millisecond
+
+	// DefaultMaxLineLength is the default maximum length of a received line in bytes.
+	DefaultMaxLineLength = 64 * 1024
+	// DefaultReadBufferSize is the default size in bytes of the buffer that is used to read from the device.
+	DefaultReadBufferSize = 1024
+	// DefaultLineBufferCapacity is the default number of received lines that are buffered until they are processed.
+	DefaultLineBufferCapacity = 1
+	// DefaultCommandDeadline is the default time after which a command that did not complete is abandoned.
+	// By default, commands are not abandoned, use WithCommandDeadline to enable the deadline.
+	DefaultCommandDeadline time.Duration = 0
 )
 
-// NewWithTrace creates a new COM instance that traces all communications to a second writer.
-func NewWithTrace(device io.ReadWriter, tracer io.Writer) *COM {
-	result := New(device)
-	result.tracer = tracer
+// ErrCommandAbandoned indicates that a command did not complete within the command deadline and was abandoned.
+var ErrCommandAbandoned = errors.New("command abandoned")
+
+// Option configures a COM instance.
+type Option func(*config)
+
+type config struct {
+	maxLineLength      int
+	readBufferSize     int
+	lineBufferCapacity int
+	commandDeadline    time.Duration
+	tracer             io.Writer
+}
+
+func newConfig(options []Option) config {
+	result := config{
+		maxLineLength:      DefaultMaxLineLength,
+		readBufferSize:     DefaultReadBufferSize,
+		lineBufferCapacity: DefaultLineBufferCapacity,
+		commandDeadline:    DefaultCommandDeadline,
+	}
+	for _, option := range options {
+		option(&result)
+	}
 	return result
 }
 
+// WithMaxLineLength sets the maximum length of a received line in bytes. Longer lines are flushed when they reach
+// the maximum length and handled as separate lines.
+func WithMaxLineLength(maxLineLength int) Option {
+	return func(c *config) {
+		if maxLineLength > 0 {
+			c.maxLineLength = maxLineLength
+		}
+	}
+}
+
+// WithReadBufferSize sets the size in bytes of the buffer that is used to read from the device.
+func WithReadBufferSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.readBufferSize = size
+		}
+	}
+}
+
+// WithLineBufferCapacity sets the number of received lines that are buffered until they are processed. No line is
+// lost if the buffer is full, but the reading from the device is blocked until the processing catches up. Meanwhile,
+// the data is only buffered by the device driver, which may overrun with high-throughput radios. A larger capacity
+// absorbs bursts of lines, e.g. while an indication handler or a command is slow.
+func WithLineBufferCapacity(capacity int) Option {
+	return func(c *config) {
+		if capacity >= 0 {
+			c.lineBufferCapacity = capacity
+		}
+	}
+}
+
+// WithCommandDeadline sets the hard deadline for commands. A command that neither completes nor is cancelled by its
+// context within the deadline is abandoned with ErrCommandAbandoned, so that the following commands can be processed.
+// A deadline of zero disables the abandoning of commands.
+func WithCommandDeadline(deadline time.Duration) Option {
+	return func(c *config) {
+		if deadline >= 0 {
+			c.commandDeadline = deadline
+		}
+	}
+}
+
+// withTracer lets the COM instance trace all communications to the given writer.
+func withTracer(tracer io.Writer) Option {
+	return func(c *config) {
+		c.tracer = tracer
+	}
+}
+
+// NewWithTrace creates a new COM instance that traces all communications to a second writer.
+func NewWithTrace(device io.ReadWriter, tracer io.Writer, options ...Option) *COM {
+	return New(device, append([]Option{withTracer(tracer)}, options...)...)
+}
+
 // New creates a new COM instance using the given io.ReadWriter to communicate with the radio's PEI.
-func New(device io.ReadWriter) *COM {
-	lines := readLoop(device)
+func New(device io.ReadWriter, options ...Option) *COM {
+	config := newConfig(options)
+	lines := readRawLoopWithConfig(device, config)
 	commands := make(chan command)
 	result := &COM{
 		commands:    commands,
 		closing:     make(chan struct{}),
 		closed:      make(chan struct{}),
+		tracer:      config.tracer,
 		indications: make(map[string]indicationConfig),
 	}
 
@@ -38,6 +126,7 @@ func New(device io.ReadWriter) *COM {
 
 		var commandCancelled <-chan struct{}
 		var activeCommand *command
+		var activeSince time.Time
 		var activeIndication *indication
 		tick := time.NewTicker(100 * time.Millisecond)
 		defer tick.Stop()
@@ -46,35 +135,45 @@ func New(device io.ReadWriter) *COM {
 			select {
 			case <-result.closing:
 				return
-			case line, valid := <-lines:
+			case rawLine, valid := <-lines:
 				if !valid {
 					return
 				}
+				line := rawLine.line
 				result.tracef("rx:  %s\nhex: %X\n--\n", line, line)
 
 				switch {
 				case activeIndication != nil:
-					activeIndication.AddLine(line)
+					activeIndication.AddLine(rawLine)
 					if activeIndication.Complete() {
 						activeIndication = nil
 					}
 				case activeCommand != nil:
-					activeIndication = result.newIndication(line)
+					if !activeCommand.ExpectsResponse(line) {
+						activeIndication = result.newIndication(rawLine)
+					}
 					if activeIndication != nil {
 						break
 					}
+					activeCommand.trace.add(Receive, line)
 					activeCommand.AddLine(line)
 					if activeCommand.Complete() {
 						commandCancelled = nil
 						activeCommand = nil
 					}
 				default:
-					activeIndication = result.newIndication(line)
+					activeIndication = result.newIndication(rawLine)
 				}
 			case <-commandCancelled:
 				commandCancelled = nil
 				activeCommand = nil
 			case <-tick.C:
+				if activeCommand != nil && config.commandDeadline > 0 && time.Since(activeSince) > config.commandDeadline {
+					result.tracef("abandoned: %s\n--\n", activeCommand.request)
+					activeCommand.Abandon()
+					commandCancelled = nil
+					activeCommand = nil
+				}
 			}
 			if activeCommand == nil {
 				select {
@@ -90,9 +189,21 @@ func New(device io.ReadWriter) *COM {
 						txbytes = append(txbytes, 0x0d, 0x0a)
 					}
 					result.tracef("tx:  %s\nhex: %X\n--\n", txbytes, txbytes)
-					device.Write(txbytes)
+					cmd.trace.add(Transmit, string(txbytes))
+					err := writeLines(device, txbytes)
+					if err != nil {
+						result.tracef("tx error: %v\n--\n", err)
+						cmd.err <- fmt.Errorf("cannot write %s: %w", cmd.request, err)
+						return
+					}
+					if cmd.fireAndForget {
+						cmd.response <- nil
+						close(cmd.completed)
+						break
+					}
 					commandCancelled = cmd.cancelled
 					activeCommand = &cmd
+					activeSince = time.Now()
 				default:
 				}
 			}
@@ -110,24 +221,67 @@ type COM struct {
 	tracer   io.Writer
 
 	indications map[string]indicationConfig
+
+	statsLock sync.Mutex
+	stats     COMStats
+}
+
+// COMStats contains metrics about the AT commands that were executed by a COM instance.
+type COMStats struct {
+	// Queued is the number of commands that currently wait to be sent to the device.
+	Queued int
+	// Completed is the number of commands that completed successfully.
+	Completed int
+	// Errors is the number of commands that failed, timed out, or were cancelled.
+	Errors int
+	// LastLatency is the time between sending the last completed command and receiving its response.
+	LastLatency time.Duration
+}
+
+// Stats returns a snapshot of the current command metrics.
+func (c *COM) Stats() COMStats {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	return c.stats
+}
+
+func (c *COM) updateStats(update func(*COMStats)) {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	update(&c.stats)
+}
+
+// rawLine contains a sanitized line together with the unsanitized bytes that were received for this line.
+type rawLine struct {
+	line string
+	raw  []byte
 }
 
-func readLoop(r io.Reader) <-chan string {
-	lines := make(chan string, 1)
+func readRawLoopWithConfig(r io.Reader, config config) <-chan rawLine {
+	maxLineLength := config.maxLineLength
+	lines := make(chan rawLine, config.lineBufferCapacity)
 	go func() {
-		buf := make([]byte, readBufferSize)
-		currentLine := make([]byte, 0, readBufferSize)
+		buf := make([]byte, config.readBufferSize)
+		currentLine := make([]byte, 0, config.readBufferSize)
+		currentRaw := make([]byte, 0, config.readBufferSize)
+		emit := func() {
+			raw := make([]byte, len(currentRaw))
+			copy(raw, currentRaw)
+			lines <- rawLine{line: string(currentLine), raw: raw}
+			currentLine = currentLine[:0]
+			currentRaw = currentRaw[:0]
+		}
 		for {
 			n, err := r.Read(buf)
 			if err == io.EOF {
 				if len(currentLine) > 0 {
-					lines <- string(currentLine)
+					emit()
 				}
 				close(lines)
 				return
 			} else if err != nil {
 				if len(currentLine) > 0 {
-					lines <- string(currentLine)
+					emit()
 				}
 				close(lines)
 				return
@@ -137,14 +291,23 @@ func readLoop(r io.Reader) <-chan string {
 				switch {
 				case b == '\n':
 					if len(currentLine) == 0 {
+						currentRaw = currentRaw[:0]
 						continue
 					}
-					lines <- string(currentLine)
-					currentLine = currentLine[:0]
+					emit()
 				case b < ' ':
-					continue
+					currentRaw = append(currentRaw, b)
 				default:
 					currentLine = append(currentLine, b)
+					currentRaw = append(currentRaw, b)
+				}
+
+				if len(currentRaw) >= maxLineLength {
+					if len(currentLine) > 0 {
+						emit()
+					} else {
+						currentRaw = currentRaw[:0]
+					}
 				}
 			}
 		}
@@ -186,7 +349,31 @@ func (c *COM) AddIndication(prefix string, trailingLines int, handler func(lines
 	return nil
 }
 
-func (c *COM) newIndication(line string) *indication {
+// AddRawIndication works like AddIndication, but the handler additionally receives the unsanitized bytes of each line
+// as they were read from the device, including any control characters, without the terminating line feed.
+func (c *COM) AddRawIndication(prefix string, trailingLines int, handler func(lines []string, raw [][]byte)) error {
+	config := indicationConfig{
+		prefix:        strings.ToUpper(prefix),
+		trailingLines: trailingLines,
+		rawHandler:    handler,
+	}
+	c.indications[config.prefix] = config
+	return nil
+}
+
+// AddIndicationUntil works like AddIndication, but the number of trailing lines depends on the content of the
+// indication: lines are added to the indication until the given function reports it as complete.
+func (c *COM) AddIndicationUntil(prefix string, complete func(lines []string) bool, handler func(lines []string)) error {
+	config := indicationConfig{
+		prefix:   strings.ToUpper(prefix),
+		complete: complete,
+		handler:  handler,
+	}
+	c.indications[config.prefix] = config
+	return nil
+}
+
+func (c *COM) newIndication(line rawLine) *indication {
 	for _, config := range c.indications {
 		result := config.NewIfMatches(line)
 		if result != nil {
@@ -216,30 +403,103 @@ func (c *COM) Request(ctx context.Context, request string) ([]string, error) {
 }
 
 func (c *COM) AT(ctx context.Context, request string) ([]string, error) {
-	cmd := command{
-		request:   request,
-		response:  make(chan []string, 1),
-		err:       make(chan error, 1),
-		cancelled: ctx.Done(),
-		completed: make(chan struct{}),
+	return c.execute(ctx, newCommand(ctx, request, false))
+}
+
+// ATWithTrace works like AT, but additionally returns the traffic that was sent and received for this single command.
+// Indications that are received while the command is active are not part of the trace.
+func (c *COM) ATWithTrace(ctx context.Context, request string) ([]string, []TraceEntry, error) {
+	cmd := newCommand(ctx, request, false)
+	cmd.trace = new(commandTrace)
+	response, err := c.execute(ctx, cmd)
+	return response, cmd.trace.Entries(), err
+}
+
+// TraceDirection indicates if a trace entry was sent or received.
+type TraceDirection int
+
+// All trace directions
+const (
+	Transmit TraceDirection = iota
+	Receive
+)
+
+// TraceEntry contains the data that was sent or received for a command.
+type TraceEntry struct {
+	Direction TraceDirection
+	Data      string
+}
+
+type commandTrace struct {
+	lock    sync.Mutex
+	entries []TraceEntry
+}
+
+func (t *commandTrace) add(direction TraceDirection, data string) {
+	if t == nil {
+		return
 	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.entries = append(t.entries, TraceEntry{Direction: direction, Data: data})
+}
+
+func (t *commandTrace) Entries() []TraceEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	result := make([]TraceEntry, len(t.entries))
+	copy(result, t.entries)
+	return result
+}
+
+// Send writes the given request to the device and returns as soon as it is written, without waiting for a response.
+// This is useful for requests whose response is an unsolicited indication.
+func (c *COM) Send(ctx context.Context, request string) error {
+	_, err := c.execute(ctx, newCommand(ctx, request, true))
+	return err
+}
+
+func (c *COM) execute(ctx context.Context, cmd command) ([]string, error) {
+	c.updateStats(func(s *COMStats) { s.Queued++ })
 
+	var err error
 	select {
 	case c.commands <- cmd:
+	case <-c.closed:
+		err = fmt.Errorf("COM closed")
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		err = ctx.Err()
 	case <-time.After(atSendingQueueTimeout):
-		return nil, fmt.Errorf("AT sending queue timeout")
+		err = fmt.Errorf("AT sending queue timeout")
+	}
+	c.updateStats(func(s *COMStats) {
+		s.Queued--
+		if err != nil {
+			s.Errors++
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	sent := time.Now()
+	var response []string
 	select {
-	case response := <-cmd.response:
-		return response, nil
-	case err := <-cmd.err:
-		return nil, err
+	case response = <-cmd.response:
+	case err = <-cmd.err:
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		err = ctx.Err()
 	}
+	c.updateStats(func(s *COMStats) {
+		if err != nil {
+			s.Errors++
+			return
+		}
+		s.Completed++
+		s.LastLatency = time.Since(sent)
+	})
+
+	return response, err
 }
 
 func (c *COM) ATs(ctx context.Context, requests ...string) error {
@@ -269,19 +529,22 @@ func (c *COM) tracef(format string, args ...interface{}) {
 type indicationConfig struct {
 	prefix        string
 	trailingLines int
+	complete      func(lines []string) bool
 	handler       func(lines []string)
+	rawHandler    func(lines []string, raw [][]byte)
 }
 
-func (c *indicationConfig) NewIfMatches(line string) *indication {
-	if !strings.HasPrefix(strings.ToUpper(line), c.prefix) {
+func (c *indicationConfig) NewIfMatches(line rawLine) *indication {
+	if !strings.HasPrefix(strings.ToUpper(line.line), c.prefix) {
 		return nil
 	}
 	result := &indication{
 		config: *c,
-		lines:  []string{line},
+		lines:  []string{line.line},
+		raw:    [][]byte{line.raw},
 	}
 	if result.Complete() {
-		c.handler([]string{line})
+		result.handle()
 		return nil
 	}
 
@@ -291,32 +554,71 @@ func (c *indicationConfig) NewIfMatches(line string) *indication {
 type indication struct {
 	config indicationConfig
 	lines  []string
+	raw    [][]byte
 }
 
-func (ind *indication) AddLine(line string) {
+func (ind *indication) AddLine(line rawLine) {
 	if ind.Complete() {
 		return
 	}
 
-	ind.lines = append(ind.lines, line)
+	ind.lines = append(ind.lines, line.line)
+	ind.raw = append(ind.raw, line.raw)
 	if ind.Complete() {
-		go func() {
-			ind.config.handler(ind.lines)
-		}()
+		go ind.handle()
+	}
+}
+
+func (ind *indication) handle() {
+	if ind.config.rawHandler != nil {
+		ind.config.rawHandler(ind.lines, ind.raw)
+		return
 	}
+	ind.config.handler(ind.lines)
 }
 
 func (ind *indication) Complete() bool {
+	if ind.config.complete != nil {
+		return ind.config.complete(ind.lines)
+	}
 	return len(ind.lines) >= ind.config.trailingLines+1
 }
 
+// writeLines writes the given data line by line to the given device, i.e. a command that spans multiple lines,
+// like AT+CMGS with its PDU, is written with one write per line.
+func writeLines(device io.Writer, data []byte) error {
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		_, err := device.Write(line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newCommand(ctx context.Context, request string, fireAndForget bool) command {
+	return command{
+		request:       request,
+		fireAndForget: fireAndForget,
+		response:      make(chan []string, 1),
+		err:           make(chan error, 1),
+		cancelled:     ctx.Done(),
+		completed:     make(chan struct{}),
+	}
+}
+
 type command struct {
-	lines     []string
-	request   string
-	response  chan []string
-	err       chan error
-	cancelled <-chan struct{}
-	completed chan struct{}
+	lines         []string
+	request       string
+	fireAndForget bool
+	trace         *commandTrace
+	response      chan []string
+	err           chan error
+	cancelled     <-chan struct{}
+	completed     chan struct{}
 }
 
 func (c *command) AddLine(line string) {
@@ -333,13 +635,13 @@ func (c *command) AddLine(line string) {
 	case saniLine == "OK":
 		c.response <- c.lines
 		close(c.completed)
-	case strings.HasPrefix(saniLine, "ERROR"):
+	case saniLine == "ERROR":
 		c.err <- fmt.Errorf("%s", line)
 		close(c.completed)
 	case strings.HasPrefix(saniLine, "+CME ERROR:"):
 		c.err <- fmt.Errorf("%s", line)
 		close(c.completed)
-	case strings.HasPrefix(saniLine, "+CMS ERROR"):
+	case strings.HasPrefix(saniLine, "+CMS ERROR:"):
 		c.err <- fmt.Errorf("%s", line)
 		close(c.completed)
 	default:
@@ -347,6 +649,30 @@ func (c *command) AddLine(line string) {
 	}
 }
 
+// ExpectsResponse indicates if the given line is an information response to this command, i.e. it starts with
+// the name of the command, e.g. "+CTGS:" for AT+CTGS?. Such lines belong to the command, even if an indication
+// with the same prefix is registered.
+func (c *command) ExpectsResponse(line string) bool {
+	request := strings.ToUpper(c.request)
+	if !strings.HasPrefix(request, "AT+") {
+		return false
+	}
+	name := request[2:]
+	if end := strings.IndexAny(name, "=?\r\n"); end != -1 {
+		name = name[:end]
+	}
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), name+":")
+}
+
+// Abandon completes this command with ErrCommandAbandoned, unless it is already complete.
+func (c *command) Abandon() {
+	if c.Complete() {
+		return
+	}
+	c.err <- fmt.Errorf("%s: %w", c.request, ErrCommandAbandoned)
+	close(c.completed)
+}
+
 func (c *command) Complete() bool {
 	select {
 	case <-c.cancelled:
@@ -2,7 +2,10 @@ package com
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,7 +14,7 @@ import (
 
 func TestReadLoop_CloseDevice(t *testing.T) {
 	device := NewInMemory()
-	lines := readLoop(device)
+	lines := readRawLoopWithConfig(device, newConfig(nil))
 	device.Close()
 
 	_, valid := <-lines
@@ -21,7 +24,7 @@ func TestReadLoop_CloseDevice(t *testing.T) {
 
 func TestReadLoop_ReadLine(t *testing.T) {
 	device := NewInMemory()
-	lines := readLoop(device)
+	lines := readRawLoopWithConfig(device, newConfig(nil))
 
 	go func() {
 		time.Sleep(100 * time.Millisecond)
@@ -31,19 +34,89 @@ func TestReadLoop_ReadLine(t *testing.T) {
 	firstLine, valid := <-lines
 
 	assert.True(t, valid)
-	assert.Equal(t, "hello", firstLine)
+	assert.Equal(t, "hello", firstLine.line)
 
 	device.Close()
 	lastLine, valid := <-lines
 
 	assert.True(t, valid)
-	assert.Equal(t, "world", lastLine)
+	assert.Equal(t, "world", lastLine.line)
 
 	_, valid = <-lines
 
 	assert.False(t, valid)
 }
 
+func TestReadLoop_MaxLineLength(t *testing.T) {
+	device := NewInMemory()
+	lines := readRawLoopWithConfig(device, newConfig([]Option{WithMaxLineLength(8)}))
+	device.PrepareRead([]byte(strings.Repeat("0123456789", 2)))
+
+	firstLine, valid := <-lines
+	assert.True(t, valid)
+	assert.Equal(t, "01234567", firstLine.line)
+
+	secondLine, valid := <-lines
+	assert.True(t, valid)
+	assert.Equal(t, "89012345", secondLine.line)
+
+	device.Close()
+	lastLine, valid := <-lines
+	assert.True(t, valid)
+	assert.Equal(t, "6789", lastLine.line)
+}
+
+func TestReadRawLoop_PreservesRawBytes(t *testing.T) {
+	device := NewInMemory()
+	lines := readRawLoopWithConfig(device, newConfig(nil))
+	device.PrepareRead([]byte("+CTSDSR: 12,1234567,0,2345678,0,16\r\n\r\n82\x1a00\r\n"))
+
+	header, valid := <-lines
+	assert.True(t, valid)
+	assert.Equal(t, "+CTSDSR: 12,1234567,0,2345678,0,16", header.line)
+	assert.Equal(t, []byte("+CTSDSR: 12,1234567,0,2345678,0,16\r"), header.raw)
+
+	pdu, valid := <-lines
+	assert.True(t, valid)
+	assert.Equal(t, "8200", pdu.line)
+	assert.Equal(t, []byte("82\x1a00\r"), pdu.raw)
+
+	device.Close()
+	_, valid = <-lines
+	assert.False(t, valid)
+}
+
+func TestCOM_SmallBuffersWithBurstOfLines(t *testing.T) {
+	device := NewInMemory()
+
+	com := New(device, WithReadBufferSize(4), WithLineBufferCapacity(2))
+	received := make(chan string, 100)
+	com.AddIndication("Ind:", 0, func(lines []string) {
+		time.Sleep(time.Millisecond) // a slow handler lets the lines pile up
+		received <- lines[0]
+	})
+
+	burst := make([]string, 50)
+	for i := range burst {
+		burst[i] = fmt.Sprintf("Ind:%d", i)
+	}
+	device.PrepareRead([]byte(strings.Join(burst, "\r\n") + "\r\n"))
+
+	actual := make([]string, 0, len(burst))
+	timeout := time.After(time.Second)
+	for len(actual) < len(burst) {
+		select {
+		case line := <-received:
+			actual = append(actual, line)
+		case <-timeout:
+			t.Fatalf("only %d of %d lines received", len(actual), len(burst))
+		}
+	}
+	device.Close()
+
+	assert.Equal(t, burst, actual)
+}
+
 func TestCOM_CloseDevice(t *testing.T) {
 	device := NewInMemory()
 	com := New(device)
@@ -93,6 +166,118 @@ func TestCOM_Indications(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%v", expected), fmt.Sprintf("%v", actual))
 }
 
+func TestCOM_RawIndication(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+
+	com := New(device)
+	type received struct {
+		lines []string
+		raw   [][]byte
+	}
+	indications := make(chan received, 1)
+	com.AddRawIndication("+CTSDSR:", 1, func(lines []string, raw [][]byte) {
+		indications <- received{lines: lines, raw: raw}
+	})
+
+	device.PrepareRead([]byte("+CTSDSR: 12,1234567,0,2345678,0,16\r\n82\x1a00\r\n"))
+
+	select {
+	case actual := <-indications:
+		assert.Equal(t, []string{"+CTSDSR: 12,1234567,0,2345678,0,16", "8200"}, actual.lines)
+		assert.Equal(t, [][]byte{[]byte("+CTSDSR: 12,1234567,0,2345678,0,16\r"), []byte("82\x1a00\r")}, actual.raw)
+	case <-time.After(time.Second):
+		t.Error("indication was not handled")
+	}
+}
+
+func TestCOM_IndicationUntil(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+
+	com := New(device)
+	indications := make(chan []string, 1)
+	com.AddIndicationUntil("Ind:", func(lines []string) bool {
+		return lines[len(lines)-1] == "end"
+	}, func(lines []string) {
+		indications <- lines
+	})
+
+	device.PrepareRead([]byte("Ind:header\r\nline1\r\nline2\r\nend\r\n"))
+
+	select {
+	case actual := <-indications:
+		assert.Equal(t, []string{"Ind:header", "line1", "line2", "end"}, actual)
+	case <-time.After(time.Second):
+		t.Error("indication was not handled")
+	}
+}
+
+func TestCOM_WriteLineByLine(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+
+	err := com.Send(context.Background(), "AT+CMGS=1234567,32\r\n8210\r\n00C9\x1a")
+	assert.NoError(t, err)
+
+	for _, expected := range []string{"AT+CMGS=1234567,32", "8210", "00C9"} {
+		actual, err := device.NextWrite(time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestCOM_ResponseWithIndicationPrefix(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+	indications := make(chan []string, 1)
+	com.AddIndication("+CTGS: ", 0, func(lines []string) {
+		indications <- lines
+	})
+	go func() {
+		device.WaitUntilWritten()
+		time.Sleep(10 * time.Millisecond)
+		device.PrepareRead([]byte("+CTGS: 1,1234\r\nOK\r\n"))
+	}()
+
+	response, err := com.AT(context.Background(), "AT+CTGS?")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"+CTGS: 1,1234"}, response)
+
+	device.PrepareRead([]byte("+CTGS: 1,2345\r\n"))
+	select {
+	case lines := <-indications:
+		assert.Equal(t, []string{"+CTGS: 1,2345"}, lines)
+	case <-time.After(time.Second):
+		t.Error("indication was not handled")
+	}
+}
+
+func TestCommand_ExpectsResponse(t *testing.T) {
+	tt := []struct {
+		request  string
+		line     string
+		expected bool
+	}{
+		{request: "AT+CTGS?", line: "+CTGS: 1,1234", expected: true},
+		{request: "at+ctgs?", line: "+CTGS: 1,1234", expected: true},
+		{request: "AT+CREG?", line: "+CREG: 1", expected: true},
+		{request: "AT+CMGS=1234567,16\r\n8200\x1a", line: "+CMGS: 0,4", expected: true},
+		{request: "AT+CTGS?", line: "+CTSDSR: 12,1234567,0,2345678,0,16"},
+		{request: "AT+CTGS?", line: "OK"},
+		{request: "ATZ", line: "+CTGS: 1,1234"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.request, func(t *testing.T) {
+			cmd := command{request: tc.request}
+			assert.Equal(t, tc.expected, cmd.ExpectsResponse(tc.line))
+		})
+	}
+}
+
 func TestCOM_SimpleCommand(t *testing.T) {
 	device := NewInMemory()
 	defer device.Close()
@@ -107,6 +292,27 @@ func TestCOM_SimpleCommand(t *testing.T) {
 	assert.Empty(t, response)
 }
 
+func TestCOM_Send(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := com.Send(ctx, "AT+CMGS=1234567,32\r\n821000C9\x1a")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "AT+CMGS=1234567,32\r\n821000C9\x1a", string(device.Written()))
+
+	go func() {
+		device.WaitUntilWritten()
+		time.Sleep(10 * time.Millisecond)
+		device.PrepareRead([]byte("OK\r\n"))
+	}()
+	_, err = com.AT(ctx, "AT")
+	assert.NoError(t, err)
+}
+
 func TestCOM_CommandWithData(t *testing.T) {
 	device := NewInMemory()
 	defer device.Close()
@@ -144,13 +350,28 @@ func TestCOM_CommandWithError(t *testing.T) {
 	go func() {
 		device.WaitUntilWritten()
 		time.Sleep(10 * time.Millisecond)
-		device.PrepareRead([]byte("first line\r\nError at last\r\n"))
+		device.PrepareRead([]byte("first line\r\nError\r\n"))
 	}()
 	response, err := com.AT(context.Background(), "AT")
 	assert.Error(t, err)
 	assert.Empty(t, response)
 }
 
+func TestCOM_CommandWithBenignErrorLine(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+	go func() {
+		device.WaitUntilWritten()
+		time.Sleep(10 * time.Millisecond)
+		device.PrepareRead([]byte("first line\r\nError at last\r\nno error here\r\nOK\r\n"))
+	}()
+	expected := []string{"first line", "Error at last", "no error here"}
+	actual, err := com.AT(context.Background(), "AT")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
 func TestCOM_CommandWithCMEError(t *testing.T) {
 	device := NewInMemory()
 	defer device.Close()
@@ -178,3 +399,133 @@ func TestCOM_CommandWithCMSError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Empty(t, response)
 }
+
+type failingWriteDevice struct {
+	*InMemory
+	err error
+}
+
+func (d *failingWriteDevice) Write(p []byte) (int, error) {
+	return 0, d.err
+}
+
+func TestCOM_AbandonStuckCommand(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device, WithCommandDeadline(200*time.Millisecond))
+
+	stuck := make(chan error, 1)
+	go func() {
+		_, err := com.AT(context.Background(), "AT+STUCK")
+		stuck <- err
+	}()
+	written, err := device.NextWrite(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "AT+STUCK", written)
+
+	go func() {
+		written, err := device.NextWrite(time.Second)
+		if err == nil && written == "AT" {
+			device.PrepareRead([]byte("OK\r\n"))
+		}
+	}()
+	_, err = com.AT(context.Background(), "AT")
+	assert.NoError(t, err)
+
+	select {
+	case err := <-stuck:
+		assert.ErrorIs(t, err, ErrCommandAbandoned)
+	case <-time.After(time.Second):
+		t.Error("stuck command was not abandoned")
+	}
+}
+
+func TestNewWithTrace_Options(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := NewWithTrace(device, io.Discard, WithCommandDeadline(200*time.Millisecond))
+
+	_, err := com.AT(context.Background(), "AT+STUCK")
+
+	assert.ErrorIs(t, err, ErrCommandAbandoned)
+}
+
+func TestNewConfig_CommandDeadline(t *testing.T) {
+	assert.Equal(t, time.Duration(0), newConfig(nil).commandDeadline)
+	assert.Equal(t, time.Minute, newConfig([]Option{WithCommandDeadline(time.Minute)}).commandDeadline)
+}
+
+func TestCOM_WriteError(t *testing.T) {
+	writeErr := errors.New("device gone")
+	device := &failingWriteDevice{InMemory: NewInMemory(), err: writeErr}
+	defer device.Close()
+	com := New(device)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	response, err := com.AT(ctx, "AT")
+
+	assert.ErrorIs(t, err, writeErr)
+	assert.Empty(t, response)
+
+	com.WaitUntilClosed(ctx)
+	assert.True(t, com.Closed())
+
+	_, err = com.AT(ctx, "AT")
+	assert.Error(t, err)
+}
+
+func TestCOM_Stats(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+
+	respond := func(response string) {
+		go func() {
+			device.WaitUntilWritten()
+			time.Sleep(10 * time.Millisecond)
+			device.PrepareRead([]byte(response))
+		}()
+	}
+
+	assert.Equal(t, COMStats{}, com.Stats())
+
+	respond("OK\r\n")
+	_, err := com.AT(context.Background(), "AT")
+	assert.NoError(t, err)
+
+	respond("OK\r\n")
+	_, err = com.AT(context.Background(), "AT")
+	assert.NoError(t, err)
+
+	respond("+CME ERROR: 35\r\n")
+	_, err = com.AT(context.Background(), "AT")
+	assert.Error(t, err)
+
+	stats := com.Stats()
+	assert.Equal(t, 0, stats.Queued)
+	assert.Equal(t, 2, stats.Completed)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Greater(t, stats.LastLatency, time.Duration(0))
+}
+
+func TestCOM_ATWithTrace(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+	go func() {
+		device.WaitUntilWritten()
+		time.Sleep(10 * time.Millisecond)
+		device.PrepareRead([]byte("+CTOM: 0\r\nOK\r\n"))
+	}()
+
+	response, trace, err := com.ATWithTrace(context.Background(), "AT+CTOM?")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"+CTOM: 0"}, response)
+	assert.Equal(t, []TraceEntry{
+		{Direction: Transmit, Data: "AT+CTOM?\r\n"},
+		{Direction: Receive, Data: "+CTOM: 0"},
+		{Direction: Receive, Data: "OK"},
+	}, trace)
+}
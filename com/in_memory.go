@@ -1,7 +1,9 @@
 package com
 
 import (
+	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,6 +12,7 @@ func NewInMemory() *InMemory {
 	return &InMemory{
 		readBuffer:  []byte{},
 		writeBuffer: []byte{},
+		writes:      []string{},
 		readLock:    new(sync.RWMutex),
 		writeLock:   new(sync.RWMutex),
 		writeSignal: make(chan bool),
@@ -20,6 +23,8 @@ func NewInMemory() *InMemory {
 type InMemory struct {
 	readBuffer     []byte
 	writeBuffer    []byte
+	writes         []string
+	nextWrite      int
 	readLock       *sync.RWMutex
 	writeLock      *sync.RWMutex
 	writeSignal    chan bool
@@ -117,6 +122,7 @@ func (rw *InMemory) Write(p []byte) (int, error) {
 	defer rw.writeLock.Unlock()
 
 	rw.writeBuffer = append(rw.writeBuffer, p...)
+	rw.writes = append(rw.writes, string(p))
 	select {
 	case rw.writeSignal <- true:
 	default:
@@ -136,6 +142,45 @@ func (rw *InMemory) ClearWrite() {
 	defer rw.writeLock.Unlock()
 
 	rw.writeBuffer = []byte{}
+	rw.writes = []string{}
+	rw.nextWrite = 0
+}
+
+// WrittenLines returns the written data split at the command terminators CR LF, Ctrl-Z, and ESC. Empty lines are omitted.
+// The PDU of a message is a line of its own.
+func (rw *InMemory) WrittenLines() []string {
+	rw.writeLock.RLock()
+	defer rw.writeLock.RUnlock()
+
+	return strings.FieldsFunc(strings.ReplaceAll(string(rw.writeBuffer), "\r\n", "\x1a"), func(r rune) bool {
+		return r == 0x1a || r == 0x1b
+	})
+}
+
+// NextWrite waits for the next write and returns the written line without its trailing terminator. A COM writes
+// a command that spans multiple lines line by line, e.g. AT+CMGS and its PDU are returned by separate calls.
+// Writes that happened before are returned in order without waiting. If nothing is written within the
+// given timeout, NextWrite returns an error.
+func (rw *InMemory) NextWrite(timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+	for {
+		rw.writeLock.Lock()
+		if rw.nextWrite < len(rw.writes) {
+			result := rw.writes[rw.nextWrite]
+			rw.nextWrite++
+			rw.writeLock.Unlock()
+			return strings.TrimRight(result, "\r\n\x1a\x1b"), nil
+		}
+		rw.writeLock.Unlock()
+
+		select {
+		case <-rw.closed:
+			return "", io.EOF
+		case <-deadline:
+			return "", fmt.Errorf("nothing written within %v", timeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
 }
 
 func (rw *InMemory) WaitUntilWritten() {
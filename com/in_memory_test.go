@@ -1,11 +1,13 @@
 package com
 
 import (
+	"context"
 	"io"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInMemory_Read(t *testing.T) {
@@ -78,3 +80,37 @@ func TestWrite(t *testing.T) {
 	rw.ClearWrite()
 	assert.Equal(t, "", string(rw.Written()))
 }
+
+func TestWrittenLines(t *testing.T) {
+	rw := NewInMemory()
+
+	rw.Write([]byte("AT+CTSDS=12,0\r\n"))
+	rw.Write([]byte("AT+CMGS=1234567,32\r\n821000C9\x1a"))
+	rw.Write([]byte("AT\r\n"))
+
+	assert.Equal(t, []string{"AT+CTSDS=12,0", "AT+CMGS=1234567,32", "821000C9", "AT"}, rw.WrittenLines())
+}
+
+func TestInMemory_NextWrite(t *testing.T) {
+	device := NewInMemory()
+	defer device.Close()
+	com := New(device)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() {
+		for _, request := range []string{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32\r\n821000C9\x1a"} {
+			com.Send(ctx, request)
+		}
+	}()
+
+	expected := []string{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32", "821000C9"}
+	for _, e := range expected {
+		actual, err := device.NextWrite(time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, e, actual)
+	}
+
+	_, err := device.NextWrite(20 * time.Millisecond)
+	assert.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ftl/tetra-pei/sds"
 	"github.com/ftl/tetra-pei/tetra"
 )
 
@@ -36,10 +37,22 @@ func RequestOperatingMode(ctx context.Context, requester tetra.Requester) (AIMod
 }
 
 // SetTalkgroup according to [PEI] 6.15.6.2
+//
+// Deprecated: SetTalkgroup does not validate the given GTSI, use SetTalkgroupChecked instead.
 func SetTalkgroup(gtsi string) string {
 	return fmt.Sprintf("AT+CTGS=1,%s", gtsi)
 }
 
+// SetTalkgroupChecked returns the command to select the given talkgroup according to [PEI] 6.15.6.2.
+// The GTSI is validated first (see tetra.ParseGTSI).
+func SetTalkgroupChecked(gtsi string) (string, error) {
+	parsedGTSI, err := tetra.ParseGTSI(gtsi)
+	if err != nil {
+		return "", err
+	}
+	return SetTalkgroup(parsedGTSI.String()), nil
+}
+
 const talkgroupRequest = "AT+CTGS?"
 
 var talkgroupResponse = regexp.MustCompile(`^\+CTGS: .*,(\d+)$`)
@@ -54,6 +67,122 @@ func RequestTalkgroup(ctx context.Context, requester tetra.Requester) (string, e
 	return parts[1], nil
 }
 
+var talkgroupIndication = regexp.MustCompile(`^\+CTGS: (\d+),(\d+)$`)
+
+// ParseTalkgroupIndication parses the unsolicited +CTGS indication that the radio sends when the selected talkgroup changes.
+func ParseTalkgroupIndication(line string) (string, error) {
+	parts := talkgroupIndication.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(line)))
+	if len(parts) != 3 {
+		return "", fmt.Errorf("unexpected talkgroup indication: %s", line)
+	}
+
+	gtsi, err := tetra.ParseGTSI(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	return gtsi.String(), nil
+}
+
+// RegistrationStatus according to [PEI] 6.15.1
+type RegistrationStatus int
+
+// All registration status values
+const (
+	NotRegistered RegistrationStatus = iota
+	RegisteredHome
+	SearchingNetwork
+	RegistrationDenied
+	UnknownRegistration
+	RegisteredRoaming
+)
+
+// Registration contains the information of a +CREG indication.
+type Registration struct {
+	Status       RegistrationStatus
+	LocationArea string
+	MNI          string
+}
+
+// Registered indicates if the radio is registered to a network.
+func (r Registration) Registered() bool {
+	return r.Status == RegisteredHome || r.Status == RegisteredRoaming
+}
+
+var registrationIndication = regexp.MustCompile(`^\+CREG: (\d+)(?:,(\d*)(?:,(\d*))?)?$`)
+
+// ParseRegistrationIndication parses the unsolicited +CREG indication that the radio sends when its registration changes.
+func ParseRegistrationIndication(line string) (Registration, error) {
+	parts := registrationIndication.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(line)))
+	if len(parts) != 4 {
+		return Registration{}, fmt.Errorf("unexpected registration indication: %s", line)
+	}
+
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Registration{}, err
+	}
+
+	return Registration{
+		Status:       RegistrationStatus(status),
+		LocationArea: parts[2],
+		MNI:          parts[3],
+	}, nil
+}
+
+// IndicationRegistry allows to register handlers for unsolicited indications, e.g. com.COM.
+type IndicationRegistry interface {
+	AddIndication(prefix string, trailingLines int, handler func(lines []string)) error
+}
+
+// StatusHandlers contains the handlers for the status indications. Nil handlers are not registered.
+type StatusHandlers struct {
+	Talkgroup    func(gtsi string)
+	Registration func(registration Registration)
+	Error        func(err error)
+}
+
+// AddStatusIndications registers the given handlers for the +CTGS and +CREG indications.
+// The responses to AT+CTGS? and AT+CREG? look the same as the indications, a com.COM hands them to the active
+// command nevertheless, i.e. RequestTalkgroup still works when a talkgroup handler is registered.
+func AddStatusIndications(registry IndicationRegistry, handlers StatusHandlers) error {
+	handleError := func(err error) {
+		if handlers.Error != nil {
+			handlers.Error(err)
+		}
+	}
+
+	if handlers.Talkgroup != nil {
+		err := registry.AddIndication("+CTGS: ", 0, func(lines []string) {
+			gtsi, err := ParseTalkgroupIndication(lines[0])
+			if err != nil {
+				handleError(err)
+				return
+			}
+			handlers.Talkgroup(gtsi)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if handlers.Registration != nil {
+		err := registry.AddIndication("+CREG: ", 0, func(lines []string) {
+			registration, err := ParseRegistrationIndication(lines[0])
+			if err != nil {
+				handleError(err)
+				return
+			}
+			handlers.Registration(registration)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 const (
 	talkgroupRangeRequest    = "AT+CNUM%s=?"
 	talkgroupsPrepareRequest = "AT+CNUM%s=0,%d,%d"
@@ -78,7 +207,8 @@ type TalkgroupInfo struct {
 	Name string
 }
 
-// RequestTalkgroups reads all available static talkgroups from the device, see [PEI] 6.11.5.2
+// RequestTalkgroups reads all available static talkgroups from the device, see [PEI] 6.11.5.2. If some entries have
+// an invalid GTSI, the valid entries are returned together with an *InvalidTalkgroupsError that lists the invalid ones.
 func RequestTalkgroups(ctx context.Context, requester tetra.Requester, kind TalkgroupKind, result []TalkgroupInfo) ([]TalkgroupInfo, error) {
 	rng, err := RequestTalkgroupRange(ctx, requester, kind)
 	if err != nil {
@@ -100,16 +230,37 @@ func RequestTalkgroups(ctx context.Context, requester tetra.Requester, kind Talk
 		return nil, fmt.Errorf("no response received")
 	}
 
+	var invalid []TalkgroupInfo
 	for _, line := range responses {
 		info, err := parseTalkgroupInfo(line)
 		if err != nil {
 			return nil, err
 		}
+		if _, err := tetra.ParseGTSI(info.GTSI); err != nil {
+			invalid = append(invalid, info)
+			continue
+		}
 		result = append(result, info)
 	}
+	if len(invalid) > 0 {
+		return result, &InvalidTalkgroupsError{Talkgroups: invalid}
+	}
 	return result, nil
 }
 
+// InvalidTalkgroupsError indicates that the radio reported talkgroups with an invalid GTSI.
+type InvalidTalkgroupsError struct {
+	Talkgroups []TalkgroupInfo
+}
+
+func (e *InvalidTalkgroupsError) Error() string {
+	gtsis := make([]string, len(e.Talkgroups))
+	for i, talkgroup := range e.Talkgroups {
+		gtsis[i] = talkgroup.GTSI
+	}
+	return fmt.Sprintf("invalid GTSI in %d talkgroups: %s", len(gtsis), strings.Join(gtsis, ", "))
+}
+
 var talkgroupInfoLine = regexp.MustCompile(`^(\+CNUM(S|D): )?(\d+),(\d+),(.+)`)
 
 func parseTalkgroupInfo(line string) (TalkgroupInfo, error) {
@@ -144,6 +295,119 @@ func RequestTalkgroupRange(ctx context.Context, requester tetra.Requester, kind
 	return TalkgroupRange{Min: min, Max: max}, nil
 }
 
+const supportedSDSServicesRequest = "AT+CTSDS=?"
+
+var supportedSDSServicesResponse = regexp.MustCompile(`^\+CTSDS: \(([0-9,\-]*)\)`)
+
+// RequestSupportedSDSServices reads the AI services that the radio supports for SDS according to [PEI] 6.14.6
+func RequestSupportedSDSServices(ctx context.Context, requester tetra.Requester) ([]sds.AIService, error) {
+	parts, err := requestWithSingleLineResponse(ctx, requester, supportedSDSServicesRequest, supportedSDSServicesResponse, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseValueList(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI service list: %v", err)
+	}
+
+	result := make([]sds.AIService, 0, len(values))
+	for _, value := range values {
+		result = append(result, sds.AIService(strconv.Itoa(value)))
+	}
+	return result, nil
+}
+
+const currentSDSServiceRequest = "AT+CTSDS?"
+
+var currentSDSServiceResponse = regexp.MustCompile(`^\+CTSDS: (\d+)(,.*)?$`)
+
+// RequestCurrentSDSService reads the currently selected AI service for SDS according to [PEI] 6.14.6.
+// The result can be used to seed the stack's current service (see sds.Stack.SetCurrentService).
+func RequestCurrentSDSService(ctx context.Context, requester tetra.Requester) (sds.AIService, error) {
+	parts, err := requestWithSingleLineResponse(ctx, requester, currentSDSServiceRequest, currentSDSServiceResponse, 3)
+	if err != nil {
+		return "", err
+	}
+
+	return sds.AIService(parts[1]), nil
+}
+
+var e2eeResponse = regexp.MustCompile(`^\+CTSDS: \d+,\d*,\d*,\d*,(\d+)$`)
+
+// RequestE2EEStatus reads if end-to-end encryption is selected for SDS according to [PEI] 6.14.6.
+// If the radio does not report the E2EE field, e.g. with the status AI service, E2EE is not selected.
+func RequestE2EEStatus(ctx context.Context, requester tetra.Requester) (bool, error) {
+	parts, err := requestWithSingleLineResponse(ctx, requester, currentSDSServiceRequest, currentSDSServiceResponse, 3)
+	if err != nil {
+		return false, err
+	}
+
+	e2eeParts := e2eeResponse.FindStringSubmatch(parts[0])
+	if len(e2eeParts) != 2 {
+		return false, nil
+	}
+	return e2eeParts[1] == "1", nil
+}
+
+// parseValueList parses a comma separated list of values and ranges, e.g. 0,2,9-13
+func parseValueList(s string) ([]int, error) {
+	result := make([]int, 0)
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(item), "-", 2)
+		min, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		max := min
+		if len(bounds) == 2 {
+			max, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for value := min; value <= max; value++ {
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
+
+const clockRequest = "AT+CCLK?"
+
+var clockResponse = regexp.MustCompile(`^\+CCLK: "?(\d{2})/(\d{2})/(\d{2}),(\d{2}):(\d{2}):(\d{2})([+-]\d{1,2})?"?$`)
+
+// RequestClock reads the radio's real time clock using AT+CCLK?. The optional time zone is given in quarters of an hour.
+// Without time zone, the time is interpreted as local time.
+func RequestClock(ctx context.Context, requester tetra.Requester) (time.Time, error) {
+	parts, err := requestWithSingleLineResponse(ctx, requester, clockRequest, clockResponse, 8)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	values := make([]int, 6)
+	for i := range values {
+		values[i], err = strconv.Atoi(parts[i+1])
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	location := time.Local
+	if parts[7] != "" {
+		quarters, err := strconv.Atoi(parts[7])
+		if err != nil {
+			return time.Time{}, err
+		}
+		location = time.FixedZone("", quarters*15*60)
+	}
+
+	return time.Date(2000+values[0], time.Month(values[1]), values[2], values[3], values[4], values[5], 0, location), nil
+}
+
 const batteryChargeRequest = "AT+CBC?"
 
 var batteryChargeResponse = regexp.MustCompile(`^\+CBC: .*,(\d+)$`)
@@ -180,6 +444,62 @@ func RequestSignalStrength(ctx context.Context, requester tetra.Requester) (int,
 	return -113 + (value * 2), err
 }
 
+// SetVolume sets the loudspeaker volume using AT+CLVL according to 3GPP TS 27.007 8.23. The level must be within
+// the given range of valid levels, which depends on the radio. Use RequestVolumeRange to find it out.
+func SetVolume(level int, volumeRange VolumeRange) (string, error) {
+	if !volumeRange.Contains(level) {
+		return "", fmt.Errorf("invalid volume level %d, must be within %d-%d", level, volumeRange.Min, volumeRange.Max)
+	}
+	return fmt.Sprintf("AT+CLVL=%d", level), nil
+}
+
+const volumeRequest = "AT+CLVL?"
+
+var volumeResponse = regexp.MustCompile(`^\+CLVL: (\d+)$`)
+
+// RequestVolume reads the current loudspeaker volume using AT+CLVL according to 3GPP TS 27.007 8.23.
+func RequestVolume(ctx context.Context, requester tetra.Requester) (int, error) {
+	parts, err := requestWithSingleLineResponse(ctx, requester, volumeRequest, volumeResponse, 2)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(parts[1])
+}
+
+const volumeRangeRequest = "AT+CLVL=?"
+
+var volumeRangeResponse = regexp.MustCompile(`^\+CLVL: \((\d+)-(\d+)\)$`)
+
+type VolumeRange struct {
+	Min int
+	Max int
+}
+
+// Contains indicates if the given level is within this volume range.
+func (r VolumeRange) Contains(level int) bool {
+	return r.Min <= level && level <= r.Max
+}
+
+// RequestVolumeRange reads the range of loudspeaker volume levels that the radio supports.
+func RequestVolumeRange(ctx context.Context, requester tetra.Requester) (VolumeRange, error) {
+	parts, err := requestWithSingleLineResponse(ctx, requester, volumeRangeRequest, volumeRangeResponse, 3)
+	if err != nil {
+		return VolumeRange{}, err
+	}
+
+	min, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return VolumeRange{}, fmt.Errorf("cannot parse range minimum: %v", err)
+	}
+	max, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return VolumeRange{}, fmt.Errorf("cannot parse range maximum: %v", err)
+	}
+
+	return VolumeRange{Min: min, Max: max}, nil
+}
+
 const gpsPositionRequest = "AT+GPSPOS?"
 
 var gpsPositionResponse = regexp.MustCompile(`^\+GPSPOS: (\d{2}):(\d{2}):(\d{2}),(N|S): (\d{2})_(\d{2}.\d{4}),(W|E): (\d{3})_(\d{2}.\d{4}),(\d+)$`)
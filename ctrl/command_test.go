@@ -1,9 +1,16 @@
 package ctrl
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/ftl/tetra-pei/com"
+	"github.com/ftl/tetra-pei/sds"
+	"github.com/ftl/tetra-pei/tetra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGPSPositionResponse(t *testing.T) {
@@ -97,3 +104,414 @@ func TestParseTalkgroupInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTalkgroup(t *testing.T) {
+	assert.Equal(t, "AT+CTGS=1,1234", SetTalkgroup("1234"))
+}
+
+func TestSetTalkgroupChecked(t *testing.T) {
+	tt := []struct {
+		gtsi     string
+		expected string
+		invalid  bool
+	}{
+		{gtsi: "123456712341234", expected: "AT+CTGS=1,123456712341234"},
+		{gtsi: "1234", expected: "AT+CTGS=1,1234"},
+		{gtsi: "", invalid: true},
+		{gtsi: "12345671234123x", invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.gtsi, func(t *testing.T) {
+			actual, err := SetTalkgroupChecked(tc.gtsi)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestTalkgroups_InvalidGTSI(t *testing.T) {
+	requester := func(_ context.Context, request string) ([]string, error) {
+		switch request {
+		case "AT+CNUMS=?":
+			return []string{"+CNUMS: (0),(1-3),(1-3)"}, nil
+		case "AT+CNUMS=0,1,3":
+			return []string{}, nil
+		case "AT+CNUMS?":
+			return []string{
+				"+CNUMS: 1,262100112345678,Group 1",
+				"+CNUMS: 2,123456789,Invalid Group",
+				"+CNUMS: 3,1234,Group 3",
+			}, nil
+		default:
+			return nil, fmt.Errorf("unexpected request %s", request)
+		}
+	}
+
+	actual, err := RequestTalkgroups(context.Background(), tetra.RequesterFunc(requester), TalkgroupStatic, nil)
+
+	var invalidErr *InvalidTalkgroupsError
+	require.ErrorAs(t, err, &invalidErr)
+	assert.Equal(t, []TalkgroupInfo{{GTSI: "123456789", Name: "Invalid Group"}}, invalidErr.Talkgroups)
+	assert.Equal(t, []TalkgroupInfo{
+		{GTSI: "262100112345678", Name: "Group 1"},
+		{GTSI: "1234", Name: "Group 3"},
+	}, actual)
+}
+
+func TestRequestSupportedSDSServices(t *testing.T) {
+	tt := []struct {
+		desc     string
+		response []string
+		expected []sds.AIService
+		invalid  bool
+	}{
+		{
+			desc:    "empty",
+			invalid: true,
+		},
+		{
+			desc:     "SDS-TL and status",
+			response: []string{"+CTSDS: (12,13),(0),(0),(0),(0,1)"},
+			expected: []sds.AIService{sds.SDSTLService, sds.StatusService},
+		},
+		{
+			desc:     "range",
+			response: []string{"+CTSDS: (9-13),(0,1),(0),(0),(0,1)"},
+			expected: []sds.AIService{sds.SDS1Service, sds.SDS2Service, sds.SDS3Service, sds.SDSTLService, sds.StatusService},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			requester := func(_ context.Context, request string) ([]string, error) {
+				assert.Equal(t, "AT+CTSDS=?", request)
+				return tc.response, nil
+			}
+			actual, err := RequestSupportedSDSServices(context.Background(), tetra.RequesterFunc(requester))
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestClock(t *testing.T) {
+	tt := []struct {
+		desc     string
+		response []string
+		expected time.Time
+		invalid  bool
+	}{
+		{
+			desc:    "empty",
+			invalid: true,
+		},
+		{
+			desc:     "with time zone",
+			response: []string{`+CCLK: "21/04/11,10:15:30+08"`},
+			expected: time.Date(2021, time.April, 11, 8, 15, 30, 0, time.UTC),
+		},
+		{
+			desc:     "negative time zone",
+			response: []string{`+CCLK: "21/04/11,10:15:30-04"`},
+			expected: time.Date(2021, time.April, 11, 11, 15, 30, 0, time.UTC),
+		},
+		{
+			desc:     "without time zone",
+			response: []string{`+CCLK: "21/04/11,10:15:30"`},
+			expected: time.Date(2021, time.April, 11, 10, 15, 30, 0, time.Local),
+		},
+		{
+			desc:     "invalid format",
+			response: []string{`+CCLK: "2021-04-11 10:15:30"`},
+			invalid:  true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			requester := func(_ context.Context, request string) ([]string, error) {
+				assert.Equal(t, "AT+CCLK?", request)
+				return tc.response, nil
+			}
+			actual, err := RequestClock(context.Background(), tetra.RequesterFunc(requester))
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, tc.expected.Equal(actual), "expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestClock_AsStackClock(t *testing.T) {
+	requester := func(_ context.Context, request string) ([]string, error) {
+		return []string{`+CCLK: "22/01/02,10:15:30"`}, nil
+	}
+	radioTime, err := RequestClock(context.Background(), tetra.RequesterFunc(requester))
+	assert.NoError(t, err)
+
+	var message sds.Message
+	stack := sds.NewStack().
+		WithReferenceClock(sds.ClockFunc(func() time.Time { return radioTime })).
+		WithMessageCallback(func(m sds.Message) {
+			message = m
+		})
+
+	// December 31st, 23:00 local time, received on January 2nd
+	part, err := sds.ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,88", "8200C9810CFDC074657374")
+	assert.NoError(t, err)
+	err = stack.Put(part)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2021, message.Timestamp.Year())
+	assert.Equal(t, time.December, message.Timestamp.Month())
+}
+
+func TestParseTalkgroupIndication(t *testing.T) {
+	tt := []struct {
+		value    string
+		expected string
+		invalid  bool
+	}{
+		{value: "+CTGS: 1,1000", expected: "1000"},
+		{value: "+CTGS: 1,262100001000", invalid: true},
+		{value: "+CTGS: 1,262000100001000", expected: "262000100001000"},
+		{value: "+CTGS: 1", invalid: true},
+		{value: "+CREG: 1", invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			actual, err := ParseTalkgroupIndication(tc.value)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseRegistrationIndication(t *testing.T) {
+	tt := []struct {
+		value    string
+		expected Registration
+		invalid  bool
+	}{
+		{value: "+CREG: 0", expected: Registration{Status: NotRegistered}},
+		{value: "+CREG: 1,1234,2620001", expected: Registration{Status: RegisteredHome, LocationArea: "1234", MNI: "2620001"}},
+		{value: "+CREG: 5,17,", expected: Registration{Status: RegisteredRoaming, LocationArea: "17"}},
+		{value: "+CREG: ", invalid: true},
+		{value: "+CTGS: 1,1000", invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			actual, err := ParseRegistrationIndication(tc.value)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+type indicationRegistryMock map[string]func([]string)
+
+func (m indicationRegistryMock) AddIndication(prefix string, _ int, handler func([]string)) error {
+	m[prefix] = handler
+	return nil
+}
+
+func TestAddStatusIndications(t *testing.T) {
+	registry := make(indicationRegistryMock)
+	var talkgroup string
+	var registration Registration
+	var errs []error
+
+	err := AddStatusIndications(registry, StatusHandlers{
+		Talkgroup:    func(gtsi string) { talkgroup = gtsi },
+		Registration: func(r Registration) { registration = r },
+		Error:        func(err error) { errs = append(errs, err) },
+	})
+	assert.NoError(t, err)
+	assert.Len(t, registry, 2)
+
+	registry["+CTGS: "]([]string{"+CTGS: 1,1000"})
+	registry["+CREG: "]([]string{"+CREG: 1,1234,2620001"})
+	registry["+CREG: "]([]string{"+CREG: invalid"})
+
+	assert.Equal(t, "1000", talkgroup)
+	assert.True(t, registration.Registered())
+	assert.Len(t, errs, 1)
+}
+
+func TestAddStatusIndications_RequestTalkgroupThroughCOM(t *testing.T) {
+	device := com.NewInMemory()
+	defer device.Close()
+	radio := com.New(device)
+
+	talkgroups := make(chan string, 1)
+	err := AddStatusIndications(radio, StatusHandlers{
+		Talkgroup: func(gtsi string) { talkgroups <- gtsi },
+	})
+	require.NoError(t, err)
+	go func() {
+		written, err := device.NextWrite(time.Second)
+		if err == nil && written == "AT+CTGS?" {
+			device.PrepareRead([]byte("+CTGS: 1,1000\r\nOK\r\n"))
+		}
+	}()
+
+	talkgroup, err := RequestTalkgroup(context.Background(), radio)
+
+	require.NoError(t, err)
+	assert.Equal(t, "1000", talkgroup)
+	assert.Empty(t, talkgroups)
+}
+
+func TestRequestCurrentSDSService(t *testing.T) {
+	tt := []struct {
+		desc     string
+		response []string
+		expected sds.AIService
+		invalid  bool
+	}{
+		{
+			desc:    "empty",
+			invalid: true,
+		},
+		{
+			desc:     "SDS-TL",
+			response: []string{"+CTSDS: 12,0,0,0,1"},
+			expected: sds.SDSTLService,
+		},
+		{
+			desc:     "status, only AI service",
+			response: []string{"+CTSDS: 13"},
+			expected: sds.StatusService,
+		},
+		{
+			desc:     "supported services",
+			response: []string{"+CTSDS: (12,13),(0),(0),(0),(0,1)"},
+			invalid:  true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			requester := func(_ context.Context, request string) ([]string, error) {
+				assert.Equal(t, "AT+CTSDS?", request)
+				return tc.response, nil
+			}
+			actual, err := RequestCurrentSDSService(context.Background(), tetra.RequesterFunc(requester))
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSetVolume(t *testing.T) {
+	volumeRange := VolumeRange{Min: 1, Max: 9}
+	tt := []struct {
+		level    int
+		expected string
+		invalid  bool
+	}{
+		{level: 5, expected: "AT+CLVL=5"},
+		{level: 1, expected: "AT+CLVL=1"},
+		{level: 9, expected: "AT+CLVL=9"},
+		{level: 0, invalid: true},
+		{level: 10, invalid: true},
+		{level: -1, invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(fmt.Sprint(tc.level), func(t *testing.T) {
+			actual, err := SetVolume(tc.level, volumeRange)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestVolume(t *testing.T) {
+	requester := func(_ context.Context, request string) ([]string, error) {
+		switch request {
+		case "AT+CLVL?":
+			return []string{"+CLVL: 4"}, nil
+		case "AT+CLVL=?":
+			return []string{"+CLVL: (0-9)"}, nil
+		default:
+			return nil, fmt.Errorf("unexpected request %s", request)
+		}
+	}
+
+	volume, err := RequestVolume(context.Background(), tetra.RequesterFunc(requester))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, volume)
+
+	volumeRange, err := RequestVolumeRange(context.Background(), tetra.RequesterFunc(requester))
+	assert.NoError(t, err)
+	assert.Equal(t, VolumeRange{Min: 0, Max: 9}, volumeRange)
+	assert.True(t, volumeRange.Contains(volume))
+	assert.False(t, volumeRange.Contains(10))
+}
+
+func TestRequestE2EEStatus(t *testing.T) {
+	tt := []struct {
+		desc     string
+		response []string
+		expected bool
+		invalid  bool
+	}{
+		{
+			desc:    "empty",
+			invalid: true,
+		},
+		{
+			desc:     "SDS-TL with E2EE",
+			response: []string{"+CTSDS: 12,0,0,0,1"},
+			expected: true,
+		},
+		{
+			desc:     "SDS-TL without E2EE",
+			response: []string{"+CTSDS: 12,0,0,0,0"},
+			expected: false,
+		},
+		{
+			desc:     "status",
+			response: []string{"+CTSDS: 13,0"},
+			expected: false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			requester := func(_ context.Context, request string) ([]string, error) {
+				assert.Equal(t, "AT+CTSDS?", request)
+				return tc.response, nil
+			}
+			actual, err := RequestE2EEStatus(context.Background(), tetra.RequesterFunc(requester))
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
@@ -16,6 +16,25 @@ type Encoder interface {
 
 type EncoderFunc func() ([]byte, int)
 
+// lengthEncoder is implemented by PDUs that know the length of their encoded form in bytes.
+type lengthEncoder interface {
+	Encoder
+	Length() int
+}
+
+// defaultPDUCapacity is the initial capacity of the buffer for PDUs that do not know the length of their encoded form.
+const defaultPDUCapacity = 256
+
+// EncodeMessage encodes the given message into a new buffer. If the message knows the length of its encoded form,
+// the buffer is pre-sized accordingly to avoid reallocations while encoding.
+func EncodeMessage(message Encoder) ([]byte, int) {
+	capacity := defaultPDUCapacity
+	if m, ok := message.(lengthEncoder); ok {
+		capacity = m.Length()
+	}
+	return message.Encode(make([]byte, 0, capacity), 0)
+}
+
 func (f EncoderFunc) Encode() ([]byte, int) {
 	return f()
 }
@@ -32,12 +51,159 @@ const (
 	SwitchToStatus = "AT+CTSDS=13,0"
 )
 
+// SendConfig defines the line endings that are used to send messages. Some radios deviate from [PEI] 6.13.2
+// and expect different line endings.
+type SendConfig struct {
+	// CommandTerminator ends the AT+CMGS command line, in front of the PDU.
+	CommandTerminator string
+	// DataTerminator ends the PDU.
+	DataTerminator string
+}
+
+// DefaultSendConfig uses the line endings defined in [PEI] 6.13.2.
+var DefaultSendConfig = SendConfig{
+	CommandTerminator: CRLF,
+	DataTerminator:    CtrlZ,
+}
+
+// SwitchToSDSTLWithE2EE returns the command to select the SDS-TL AI service with ISSI addressing and the given
+// end-to-end encryption setting according to [PEI] 6.14.6. SwitchToSDSTL is the same as SwitchToSDSTLWithE2EE(true).
+func SwitchToSDSTLWithE2EE(e2ee bool) string {
+	if e2ee {
+		return SwitchToSDSTL
+	}
+	return "AT+CTSDS=12,0,0,0,0"
+}
+
 // SendMessage according to [PEI] 6.13.2
 func SendMessage(destination tetra.Identity, message Encoder) string {
-	pdu := make([]byte, 0, 256)
-	pduBits := 0
-	pdu, pduBits = message.Encode(pdu, pduBits)
-	return fmt.Sprintf("AT+CMGS=%s,%d"+CRLF+"%s"+CtrlZ, destination, pduBits, tetra.BinaryToHex(pdu))
+	return DefaultSendConfig.SendMessage(destination, message)
+}
+
+// SendMessage works like the package function SendMessage, but uses the line endings of this configuration.
+func (c SendConfig) SendMessage(destination tetra.Identity, message Encoder) string {
+	pdu, pduBits := EncodeMessage(message)
+	return fmt.Sprintf("AT+CMGS=%s,%d%s%s%s", destination, pduBits, c.CommandTerminator, tetra.BinaryToHex(pdu), c.DataTerminator)
+}
+
+// SendMessageBytes works like SendMessage, but gives the length of the PDU in bytes instead of bits.
+// [PEI] 6.13.2 defines the length in bits, use this variant only with radios that deviate from the standard
+// and expect the length in bytes.
+func SendMessageBytes(destination tetra.Identity, message Encoder) string {
+	return DefaultSendConfig.SendMessageBytes(destination, message)
+}
+
+// SendMessageBytes works like the package function SendMessageBytes, but uses the line endings of this configuration.
+func (c SendConfig) SendMessageBytes(destination tetra.Identity, message Encoder) string {
+	pdu, _ := EncodeMessage(message)
+	return fmt.Sprintf("AT+CMGS=%s,%d%s%s%s", destination, len(pdu), c.CommandTerminator, tetra.BinaryToHex(pdu), c.DataTerminator)
+}
+
+// SendStatus returns the AT command to send the given pre-coded status according to [PEI] 6.13.2.
+// Only the emergency status and network/user specific status values are allowed.
+func SendStatus(destination tetra.Identity, status Status) (string, error) {
+	if !status.Sendable() {
+		return "", fmt.Errorf("status 0x%04x is reserved and cannot be sent", uint16(status))
+	}
+	return SendMessage(destination, status), nil
+}
+
+// SendStatusBundled works like SendStatus, but returns the command to select the status AI service in front of
+// the command to send the status. The result has the shape that the stack uses for its ResponseCallback.
+func SendStatusBundled(destination tetra.Identity, status Status) ([]string, error) {
+	command, err := SendStatus(destination, status)
+	if err != nil {
+		return nil, err
+	}
+	return []string{SwitchToStatus, command}, nil
+}
+
+// SendShortReport returns the AT command to send the given SDS-SHORT-REPORT. Short reports are sent as pre-coded
+// status, hence the status AI service must be selected (see SwitchToStatus).
+func SendShortReport(destination tetra.Identity, report SDSShortReport) string {
+	return DefaultSendConfig.SendShortReport(destination, report)
+}
+
+// SendShortReport works like the package function SendShortReport, but uses the line endings of this configuration.
+func (c SendConfig) SendShortReport(destination tetra.Identity, report SDSShortReport) string {
+	return c.SendMessage(destination, report)
+}
+
+// SendTextMessageAuto returns the AT commands to send the given text as text message. If necessary, the text is split
+// into concatenated parts. The encoding is chosen from the given list of preferred encodings using ChooseEncoding.
+func SendTextMessageAuto(destination tetra.Identity, messageReference MessageReference, deliveryReport DeliveryReportRequest, preferred []TextEncoding, maxPDUBits int, text string) []string {
+	encoding := ChooseEncoding(text, preferred)
+	transfers := NewConcatenatedMessageTransfer(messageReference, deliveryReport, encoding, maxPDUBits, text)
+
+	result := make([]string, 0, len(transfers))
+	for _, transfer := range transfers {
+		result = append(result, SendMessage(destination, transfer))
+	}
+	return result
+}
+
+// SendTextMessage sends the given text as text message using the given requester. If necessary, the text is split
+// into concatenated parts (see SendTextMessageAuto), which are sent one after another. It returns the number of parts that were sent.
+func SendTextMessage(ctx context.Context, requester tetra.Requester, destination tetra.Identity, messageReference MessageReference, deliveryReport DeliveryReportRequest, preferred []TextEncoding, maxPDUBits int, text string) (int, error) {
+	parts := SendTextMessageAuto(destination, messageReference, deliveryReport, preferred, maxPDUBits, text)
+	return SendParts(ctx, requester, parts)
+}
+
+// SendParts sends the given AT commands one after another using the given requester. If one of the commands fails
+// or the context is cancelled, the remaining commands are not sent. It returns the number of commands that were sent
+// successfully. The receiver is not notified about an incomplete message, it has to discard the parts it received.
+func SendParts(ctx context.Context, requester tetra.Requester, parts []string) (int, error) {
+	for i, part := range parts {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		_, err := requester.Request(ctx, part)
+		if err != nil {
+			return i, fmt.Errorf("part %d of %d failed: %w", i+1, len(parts), err)
+		}
+	}
+	return len(parts), nil
+}
+
+// DryRun is a requester that records the commands instead of sending them. Use it with the send functions,
+// e.g. SendTextMessage, to inspect the AT commands that would be sent to the radio.
+type DryRun struct {
+	Commands []string
+}
+
+// Request records the given command and responds like a radio that accepted the command.
+func (d *DryRun) Request(_ context.Context, request string) ([]string, error) {
+	d.Commands = append(d.Commands, request)
+	return []string{}, nil
+}
+
+// SendMessageWithLineLength works like SendMessage, but splits the hex representation of the PDU
+// into continuation lines with at most the given number of characters. A com.COM writes the command line by line,
+// i.e. each write to the device contains at most one continuation line.
+func SendMessageWithLineLength(destination tetra.Identity, message Encoder, lineLength int) string {
+	return DefaultSendConfig.SendMessageWithLineLength(destination, message, lineLength)
+}
+
+// SendMessageWithLineLength works like the package function SendMessageWithLineLength, but uses the line endings of this configuration.
+func (c SendConfig) SendMessageWithLineLength(destination tetra.Identity, message Encoder, lineLength int) string {
+	pdu, pduBits := EncodeMessage(message)
+	return fmt.Sprintf("AT+CMGS=%s,%d%s%s%s", destination, pduBits, c.CommandTerminator, splitLines(tetra.BinaryToHex(pdu), lineLength, c.CommandTerminator), c.DataTerminator)
+}
+
+// splitLines splits the given string into lines with at most the given number of characters, joined by the given separator.
+func splitLines(s string, lineLength int, separator string) string {
+	if lineLength <= 0 || len(s) <= lineLength {
+		return s
+	}
+	lines := make([]string, 0, len(s)/lineLength+1)
+	for len(s) > lineLength {
+		lines = append(lines, s[:lineLength])
+		s = s[lineLength:]
+	}
+	if len(s) > 0 {
+		lines = append(lines, s)
+	}
+	return strings.Join(lines, separator)
 }
 
 var sendMessageDescription = regexp.MustCompile(`^\+CMGS: .+\(\d*-(\d*)\)$`)
@@ -2,10 +2,13 @@ package sds
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ftl/tetra-pei/tetra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRequestMaxPDUBits(t *testing.T) {
@@ -44,3 +47,263 @@ func TestRequestMaxPDUBits(t *testing.T) {
 		})
 	}
 }
+
+func TestSendTextMessageAuto(t *testing.T) {
+	tt := []struct {
+		desc     string
+		text     string
+		expected []string
+	}{
+		{
+			desc:     "pure ASCII",
+			text:     "testmessage",
+			expected: []string{"AT+CMGS=1234567,120\r\n8202C901746573746D657373616765\x1a"},
+		},
+		{
+			desc:     "cyrillic",
+			text:     "тест",
+			expected: []string{"AT+CMGS=1234567,96\r\n8202C91A0442043504410442\x1a"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual := SendTextMessageAuto("1234567", 0xC9, NoReportRequested, []TextEncoding{ISO8859_1, UTF16BE}, 1184, tc.text)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSendMessageWithLineLength(t *testing.T) {
+	message := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage")
+	tt := []struct {
+		desc       string
+		lineLength int
+		expected   string
+	}{
+		{
+			desc:       "no limit",
+			lineLength: 0,
+			expected:   "AT+CMGS=1234567,120\r\n8202C901746573746D657373616765\x1a",
+		},
+		{
+			desc:       "limit exceeds PDU",
+			lineLength: 64,
+			expected:   "AT+CMGS=1234567,120\r\n8202C901746573746D657373616765\x1a",
+		},
+		{
+			desc:       "limit exceeded",
+			lineLength: 12,
+			expected:   "AT+CMGS=1234567,120\r\n8202C9017465\r\n73746D657373\r\n616765\x1a",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual := SendMessageWithLineLength("1234567", message, tc.lineLength)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSendMessageWithLineLength_HexToBinary(t *testing.T) {
+	message := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage")
+	expected, _ := EncodeMessage(message)
+
+	command := SendMessageWithLineLength("1234567", message, 12)
+	pduHex := strings.TrimSuffix(strings.SplitN(command, CRLF, 2)[1], CtrlZ)
+	actual, err := tetra.HexToBinary(pduHex)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestSendStatus(t *testing.T) {
+	tt := []struct {
+		desc     string
+		status   Status
+		expected string
+		invalid  bool
+	}{
+		{
+			desc:     "emergency",
+			status:   NewEmergencyStatus(),
+			expected: "AT+CMGS=1234567,16\r\n0000\x1a",
+		},
+		{
+			desc:     "user defined",
+			status:   Status2,
+			expected: "AT+CMGS=1234567,16\r\n8004\x1a",
+		},
+		{
+			desc:    "reserved, lower bound",
+			status:  0x0001,
+			invalid: true,
+		},
+		{
+			desc:    "reserved, upper bound",
+			status:  0x7FFF,
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := SendStatus("1234567", tc.status)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSendStatusBundled(t *testing.T) {
+	actual, err := SendStatusBundled("1234567", Status2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AT+CTSDS=13,0", "AT+CMGS=1234567,16\r\n8004\x1a"}, actual)
+
+	_, err = SendStatusBundled("1234567", 0x0001)
+	assert.Error(t, err)
+}
+
+func TestSendTextMessage_CancelAfterFirstPart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests []string
+	requester := func(_ context.Context, request string) ([]string, error) {
+		requests = append(requests, request)
+		cancel()
+		return []string{}, nil
+	}
+
+	sent, err := SendTextMessage(ctx, tetra.RequesterFunc(requester), "1234567", 0xC9, NoReportRequested, []TextEncoding{ISO8859_1}, 128, "testmessage1testmessage2")
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, sent)
+	assert.Len(t, requests, 1)
+}
+
+func TestSendTextMessage_DryRun(t *testing.T) {
+	text := "testmessage1testmessage2testmessage3"
+
+	var transmitted []string
+	requester := func(_ context.Context, request string) ([]string, error) {
+		transmitted = append(transmitted, request)
+		return []string{}, nil
+	}
+	sent, err := SendTextMessage(context.Background(), tetra.RequesterFunc(requester), "1234567", 0xC9, NoReportRequested, []TextEncoding{ISO8859_1}, 128, text)
+	require.NoError(t, err)
+
+	dryRun := new(DryRun)
+	dryRunSent, err := SendTextMessage(context.Background(), dryRun, "1234567", 0xC9, NoReportRequested, []TextEncoding{ISO8859_1}, 128, text)
+
+	require.NoError(t, err)
+	assert.Greater(t, len(dryRun.Commands), 1)
+	assert.Equal(t, sent, dryRunSent)
+	assert.Equal(t, transmitted, dryRun.Commands)
+}
+
+func TestSendParts_StopOnFailure(t *testing.T) {
+	var requests []string
+	requester := func(_ context.Context, request string) ([]string, error) {
+		requests = append(requests, request)
+		if len(requests) == 2 {
+			return nil, fmt.Errorf("+CMS ERROR: 1")
+		}
+		return []string{}, nil
+	}
+
+	sent, err := SendParts(context.Background(), tetra.RequesterFunc(requester), []string{"part1", "part2", "part3"})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"part1", "part2"}, requests)
+}
+
+func TestSendMessageBytes(t *testing.T) {
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage")
+
+	assert.Equal(t, "AT+CMGS=1234567,120\r\n8202C901746573746D657373616765\x1a", SendMessage("1234567", transfer))
+	assert.Equal(t, "AT+CMGS=1234567,15\r\n8202C901746573746D657373616765\x1a", SendMessageBytes("1234567", transfer))
+}
+
+func TestSendShortReport(t *testing.T) {
+	report := SDSShortReport{ReportType: MessageReceivedShort, MessageReference: 0xC9}
+
+	assert.Equal(t, "AT+CMGS=1234567,16\r\n7EC9\x1a", SendShortReport("1234567", report))
+}
+
+func TestSendConfig(t *testing.T) {
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage")
+	tt := []struct {
+		desc     string
+		config   SendConfig
+		expected string
+	}{
+		{
+			desc:     "default",
+			config:   DefaultSendConfig,
+			expected: "AT+CMGS=1234567,120\r\n8202C901746573746D657373616765\x1a",
+		},
+		{
+			desc:     "CR only",
+			config:   SendConfig{CommandTerminator: "\r", DataTerminator: CtrlZ},
+			expected: "AT+CMGS=1234567,120\r8202C901746573746D657373616765\x1a",
+		},
+		{
+			desc:     "CR and ESC",
+			config:   SendConfig{CommandTerminator: "\r", DataTerminator: "\x1b"},
+			expected: "AT+CMGS=1234567,120\r8202C901746573746D657373616765\x1b",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.config.SendMessage("1234567", transfer))
+		})
+	}
+}
+
+func TestSendConfig_SendMessageWithLineLength(t *testing.T) {
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage")
+	config := SendConfig{CommandTerminator: "\r", DataTerminator: CtrlZ}
+
+	actual := config.SendMessageWithLineLength("1234567", transfer, 12)
+
+	assert.Equal(t, "AT+CMGS=1234567,120\r8202C9017465\r73746D657373\r616765\x1a", actual)
+}
+
+func TestSwitchToSDSTLWithE2EE(t *testing.T) {
+	assert.Equal(t, SwitchToSDSTL, SwitchToSDSTLWithE2EE(true))
+	assert.Equal(t, "AT+CTSDS=12,0,0,0,0", SwitchToSDSTLWithE2EE(false))
+}
+
+func TestEncodeMessage(t *testing.T) {
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage")
+	expected, expectedBits := transfer.Encode(make([]byte, 0), 0)
+
+	actual, actualBits := EncodeMessage(transfer)
+
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, expectedBits, actualBits)
+	assert.Equal(t, transfer.Length(), cap(actual))
+}
+
+func BenchmarkEncodeMessage(b *testing.B) {
+	text := strings.Repeat("this is a long concatenated message ", 30)
+	parts := NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, 2047*8, text)
+	transfer := parts[0]
+
+	b.Run("growing", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			transfer.Encode(make([]byte, 0, defaultPDUCapacity), 0)
+		}
+	})
+	b.Run("presized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			EncodeMessage(transfer)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package sds
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpiryCallback is called for each held message whose validity period expired before it was delivered.
+type ExpiryCallback func(IncomingMessage)
+
+// ForwardQueue holds incoming SDS-TRANSFER messages for a store and forward gateway until they are delivered
+// or their validity period expires.
+type ForwardQueue struct {
+	expiryCallback ExpiryCallback
+	entries        []forwardEntry
+}
+
+type forwardEntry struct {
+	message   IncomingMessage
+	expiresAt time.Time
+	infinite  bool
+}
+
+func NewForwardQueue() *ForwardQueue {
+	return &ForwardQueue{
+		entries: make([]forwardEntry, 0),
+	}
+}
+
+func (q *ForwardQueue) WithExpiryCallback(callback ExpiryCallback) *ForwardQueue {
+	q.expiryCallback = callback
+	return q
+}
+
+// Hold the given message that was received at the given time. The message must contain a SDS-TRANSFER PDU.
+// Messages without store and forward control information are held infinitely.
+func (q *ForwardQueue) Hold(message IncomingMessage, receivedAt time.Time) error {
+	sdsTransfer, ok := message.Payload.(SDSTransfer)
+	if !ok {
+		return fmt.Errorf("only SDS-TRANSFER can be held, got %T", message.Payload)
+	}
+
+	entry := forwardEntry{message: message}
+	validityPeriod := sdsTransfer.StoreForwardControl.ValidityPeriod
+	if !sdsTransfer.StoreForwardControl.Valid || validityPeriod == InfinitelyValid {
+		entry.infinite = true
+	} else {
+		entry.expiresAt = receivedAt.Add(time.Duration(validityPeriod))
+	}
+	q.entries = append(q.entries, entry)
+
+	return nil
+}
+
+// Take the oldest held message out of the queue for delivery.
+func (q *ForwardQueue) Take() (IncomingMessage, bool) {
+	if len(q.entries) == 0 {
+		return IncomingMessage{}, false
+	}
+	result := q.entries[0].message
+	q.entries = q.entries[1:]
+	return result, true
+}
+
+// Expire evicts all messages whose validity period expired at the given time and returns the number of evicted messages.
+// The expiry callback is called for each evicted message.
+func (q *ForwardQueue) Expire(now time.Time) int {
+	remaining := make([]forwardEntry, 0, len(q.entries))
+	expired := make([]IncomingMessage, 0)
+	for _, entry := range q.entries {
+		if entry.infinite || now.Before(entry.expiresAt) {
+			remaining = append(remaining, entry)
+		} else {
+			expired = append(expired, entry.message)
+		}
+	}
+	q.entries = remaining
+
+	if q.expiryCallback != nil {
+		for _, message := range expired {
+			q.expiryCallback(message)
+		}
+	}
+	return len(expired)
+}
+
+// Len returns the number of currently held messages.
+func (q *ForwardQueue) Len() int {
+	return len(q.entries)
+}
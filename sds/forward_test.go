@@ -0,0 +1,60 @@
+package sds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardQueue_Expire(t *testing.T) {
+	transfer := func(messageReference MessageReference, storeForwardControl StoreForwardControl) IncomingMessage {
+		result := testTransfer("1234567", messageReference, TextSDU{TextHeader: NewTextHeader(ISO8859_1), Text: "testmessage"})
+		payload := result.Payload.(SDSTransfer)
+		payload.StoreForwardControl = storeForwardControl
+		result.Payload = payload
+		return result
+	}
+	fiveMinutes := transfer(0xC9, StoreForwardControl{Valid: true, ValidityPeriod: ValidityPeriod(5 * time.Minute), ForwardAddressType: NoForwardAddressPresent})
+	oneHour := transfer(0xCA, StoreForwardControl{Valid: true, ValidityPeriod: ValidityPeriod(time.Hour), ForwardAddressType: NoForwardAddressPresent})
+	infinite := transfer(0xCB, StoreForwardControl{Valid: true, ValidityPeriod: InfinitelyValid, ForwardAddressType: NoForwardAddressPresent})
+	noStoreForward := transfer(0xCC, StoreForwardControl{})
+
+	expired := make([]IncomingMessage, 0)
+	queue := NewForwardQueue().WithExpiryCallback(func(m IncomingMessage) {
+		expired = append(expired, m)
+	})
+	receivedAt := time.Date(2021, time.April, 11, 10, 15, 0, 0, time.UTC)
+	for _, message := range []IncomingMessage{fiveMinutes, oneHour, infinite, noStoreForward} {
+		require.NoError(t, queue.Hold(message, receivedAt))
+	}
+
+	assert.Equal(t, 0, queue.Expire(receivedAt.Add(4*time.Minute)))
+	assert.Equal(t, 4, queue.Len())
+
+	assert.Equal(t, 1, queue.Expire(receivedAt.Add(5*time.Minute)))
+	assert.Equal(t, []IncomingMessage{fiveMinutes}, expired)
+	assert.Equal(t, 3, queue.Len())
+
+	assert.Equal(t, 1, queue.Expire(receivedAt.Add(365*24*time.Hour)))
+	assert.Equal(t, []IncomingMessage{fiveMinutes, oneHour}, expired)
+
+	next, ok := queue.Take()
+	assert.True(t, ok)
+	assert.Equal(t, infinite, next)
+	next, ok = queue.Take()
+	assert.True(t, ok)
+	assert.Equal(t, noStoreForward, next)
+	_, ok = queue.Take()
+	assert.False(t, ok)
+}
+
+func TestForwardQueue_HoldOnlySDSTransfer(t *testing.T) {
+	queue := NewForwardQueue()
+
+	err := queue.Hold(IncomingMessage{Payload: Status2}, time.Now())
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, queue.Len())
+}
@@ -0,0 +1,155 @@
+package sds
+
+import (
+	"fmt"
+
+	"github.com/ftl/tetra-pei/tetra"
+)
+
+// PDUField describes one field of a PDU, as found by InspectPDU.
+type PDUField struct {
+	// Offset of the field in bytes from the start of the PDU.
+	Offset int
+	// Length of the field in bytes.
+	Length int
+	Name   string
+	Value  string
+}
+
+func (f PDUField) String() string {
+	return fmt.Sprintf("%3d-%3d %s: %s", f.Offset, f.Offset+f.Length-1, f.Name, f.Value)
+}
+
+// InspectPDU annotates the leading bytes of the given SDS-TL PDU with the names and values of its fields. This is
+// a diagnostics aid on a best-effort basis: the inspection stops at the first region that cannot be parsed, the
+// remaining bytes are returned as one field named "unparsed".
+func InspectPDU(bytes []byte) []PDUField {
+	inspector := pduInspector{bytes: bytes}
+	inspector.inspect()
+	return inspector.fields
+}
+
+type pduInspector struct {
+	bytes  []byte
+	offset int
+	fields []PDUField
+}
+
+func (i *pduInspector) add(length int, name string, value string) {
+	i.fields = append(i.fields, PDUField{Offset: i.offset, Length: length, Name: name, Value: value})
+	i.offset += length
+}
+
+func (i *pduInspector) remaining() []byte {
+	return i.bytes[i.offset:]
+}
+
+func (i *pduInspector) inspect() {
+	defer i.addUnparsed()
+	if len(i.bytes) == 0 {
+		return
+	}
+
+	protocol := ProtocolIdentifier(i.bytes[0])
+	i.add(1, "protocol identifier", protocol.String())
+
+	switch protocol {
+	case SimpleTextMessaging, SimpleImmediateTextMessaging:
+		if len(i.remaining()) < 1 {
+			return
+		}
+		encoding := TextEncoding(i.remaining()[0])
+		i.add(1, "text encoding", fmt.Sprintf("0x%02x", byte(encoding)))
+		i.inspectText(encoding)
+	case TextMessaging, ImmediateTextMessaging, UserDataHeaderMessaging:
+		i.inspectSDSTLMessage(protocol)
+	}
+}
+
+func (i *pduInspector) inspectSDSTLMessage(protocol ProtocolIdentifier) {
+	if len(i.remaining()) < 2 {
+		return
+	}
+	byte1 := i.remaining()[0]
+	messageType := SDSTLMessageType(byte1 >> 4)
+	storeForwardControl := (byte1 & 0x01) != 0
+
+	switch messageType {
+	case SDSTransferMessage:
+		i.add(1, "SDS-TRANSFER", fmt.Sprintf("delivery report request %d, short form report %t, store/forward control %t",
+			(byte1&0x0C)>>2, (byte1&0x02) == 0, storeForwardControl))
+	case SDSReportMessage:
+		i.add(1, "SDS-REPORT", fmt.Sprintf("ack required %t, store/forward control %t", (byte1&0x08) != 0, storeForwardControl))
+		i.add(1, "delivery status", fmt.Sprintf("0x%02x", i.remaining()[0]))
+		if len(i.remaining()) < 1 {
+			return
+		}
+		i.add(1, "message reference", fmt.Sprintf("0x%02x", i.remaining()[0]))
+		return
+	case SDSAcknowledgeMessage:
+		i.add(1, "SDS-ACK", "")
+		i.add(1, "delivery status", fmt.Sprintf("0x%02x", i.remaining()[0]))
+		if len(i.remaining()) < 1 {
+			return
+		}
+		i.add(1, "message reference", fmt.Sprintf("0x%02x", i.remaining()[0]))
+		return
+	default:
+		return
+	}
+
+	i.add(1, "message reference", fmt.Sprintf("0x%02x", i.remaining()[0]))
+
+	if storeForwardControl {
+		sfc, err := ParseStoreForwardControl(i.remaining())
+		if err != nil {
+			return
+		}
+		i.add(sfc.Length(), "store/forward control", fmt.Sprintf("validity period %v, forward address type %d",
+			sfc.ValidityPeriod, sfc.ForwardAddressType))
+	}
+	if len(i.remaining()) == 0 {
+		return
+	}
+
+	header, err := ParseTextHeader(i.remaining())
+	if err != nil {
+		return
+	}
+	if header.TimestampUsed() {
+		i.add(header.Length(), "text header", fmt.Sprintf("encoding 0x%02x, timestamp %s", byte(header.Encoding), header.Timestamp.Format("01-02 15:04")))
+	} else {
+		i.add(header.Length(), "text header", fmt.Sprintf("encoding 0x%02x", byte(header.Encoding)))
+	}
+
+	if protocol == UserDataHeaderMessaging {
+		udh, err := ParseConcatenatedTextUDH(i.remaining())
+		if err != nil {
+			return
+		}
+		i.add(int(udh.HeaderLength)+1, "user data header", fmt.Sprintf("reference 0x%x, part %d of %d",
+			udh.MessageReference, udh.SequenceNumber, udh.TotalNumber))
+	}
+
+	i.inspectText(header.Encoding)
+}
+
+func (i *pduInspector) inspectText(encoding TextEncoding) {
+	remaining := i.remaining()
+	if len(remaining) == 0 {
+		return
+	}
+	text, err := DecodePayloadText(encoding, remaining)
+	if err != nil {
+		return
+	}
+	i.add(len(remaining), "text", fmt.Sprintf("%q", text))
+}
+
+func (i *pduInspector) addUnparsed() {
+	remaining := i.remaining()
+	if len(remaining) == 0 {
+		return
+	}
+	i.add(len(remaining), "unparsed", tetra.BinaryToHex(remaining))
+}
@@ -0,0 +1,56 @@
+package sds
+
+import (
+	"testing"
+
+	"github.com/ftl/tetra-pei/tetra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectPDU(t *testing.T) {
+	tt := []struct {
+		desc     string
+		pdu      string
+		expected []PDUField
+	}{
+		{
+			desc: "text transfer",
+			pdu:  "8206C901746573746D657373616765",
+			expected: []PDUField{
+				{Offset: 0, Length: 1, Name: "protocol identifier", Value: "TextMessaging"},
+				{Offset: 1, Length: 1, Name: "SDS-TRANSFER", Value: "delivery report request 1, short form report false, store/forward control false"},
+				{Offset: 2, Length: 1, Name: "message reference", Value: "0xc9"},
+				{Offset: 3, Length: 1, Name: "text header", Value: "encoding 0x01"},
+				{Offset: 4, Length: 11, Name: "text", Value: `"testmessage"`},
+			},
+		},
+		{
+			desc: "truncated user data header",
+			pdu:  "8A00C9010500",
+			expected: []PDUField{
+				{Offset: 0, Length: 1, Name: "protocol identifier", Value: "UserDataHeaderMessaging"},
+				{Offset: 1, Length: 1, Name: "SDS-TRANSFER", Value: "delivery report request 0, short form report true, store/forward control false"},
+				{Offset: 2, Length: 1, Name: "message reference", Value: "0xc9"},
+				{Offset: 3, Length: 1, Name: "text header", Value: "encoding 0x01"},
+				{Offset: 4, Length: 2, Name: "unparsed", Value: "0500"},
+			},
+		},
+		{
+			desc: "unsupported protocol",
+			pdu:  "C30102",
+			expected: []PDUField{
+				{Offset: 0, Length: 1, Name: "protocol identifier", Value: "0xc3"},
+				{Offset: 1, Length: 2, Name: "unparsed", Value: "0102"},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			bytes, err := tetra.HexToBinary(tc.pdu)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, InspectPDU(bytes))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package sds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* Location related types and functions */
+
+// Location represents a geographic position in decimal degrees.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%.6f,%.6f", l.Latitude, l.Longitude)
+}
+
+// ParseNMEALocation parses the position from a NMEA 0183 sentence of type GGA, RMC, or GLL. The talker ID is ignored.
+// If the sentence contains a checksum, it is verified.
+func ParseNMEALocation(sentence string) (Location, error) {
+	sentence = strings.TrimSpace(sentence)
+	if !strings.HasPrefix(sentence, "$") {
+		return Location{}, fmt.Errorf("invalid NMEA sentence, $ expected: %s", sentence)
+	}
+	body := sentence[1:]
+	if i := strings.LastIndex(body, "*"); i >= 0 {
+		checksum, err := strconv.ParseUint(body[i+1:], 16, 8)
+		if err != nil {
+			return Location{}, fmt.Errorf("invalid NMEA checksum: %s", sentence)
+		}
+		body = body[:i]
+		var actual byte
+		for _, b := range []byte(body) {
+			actual ^= b
+		}
+		if actual != byte(checksum) {
+			return Location{}, fmt.Errorf("wrong NMEA checksum, expected %02X but got %02X", actual, checksum)
+		}
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields[0]) != 5 {
+		return Location{}, fmt.Errorf("invalid NMEA sentence type: %s", fields[0])
+	}
+	var latitudeIndex int
+	switch fields[0][2:] {
+	case "GGA":
+		latitudeIndex = 2
+	case "RMC":
+		latitudeIndex = 3
+	case "GLL":
+		latitudeIndex = 1
+	default:
+		return Location{}, fmt.Errorf("NMEA sentence type %s is not supported", fields[0])
+	}
+	if len(fields) < latitudeIndex+4 {
+		return Location{}, fmt.Errorf("NMEA sentence too short: %s", sentence)
+	}
+
+	latitude, err := parseNMEACoordinate(fields[latitudeIndex], fields[latitudeIndex+1], 2)
+	if err != nil {
+		return Location{}, err
+	}
+	longitude, err := parseNMEACoordinate(fields[latitudeIndex+2], fields[latitudeIndex+3], 3)
+	if err != nil {
+		return Location{}, err
+	}
+
+	return Location{Latitude: latitude, Longitude: longitude}, nil
+}
+
+func parseNMEACoordinate(value string, direction string, degreeDigits int) (float64, error) {
+	if len(value) < degreeDigits+2 {
+		return 0, fmt.Errorf("invalid NMEA coordinate: %s", value)
+	}
+	degrees, err := strconv.ParseFloat(value[:degreeDigits], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %s: %v", value, err)
+	}
+	minutes, err := strconv.ParseFloat(value[degreeDigits:], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %s: %v", value, err)
+	}
+
+	result := degrees + minutes/60
+	switch direction {
+	case "N", "E":
+		return result, nil
+	case "S", "W":
+		return -result, nil
+	default:
+		return 0, fmt.Errorf("invalid NMEA direction: %s", direction)
+	}
+}
+
+// Location returns the first location that is embedded as NMEA sentence in one of the information elements
+// of the user data header. Information elements that do not contain a valid NMEA sentence are ignored.
+func (t ConcatenatedTextSDU) Location() (Location, bool) {
+	for _, element := range t.UserDataHeader.OtherElements {
+		location, err := ParseNMEALocation(string(element.Data))
+		if err == nil {
+			return location, true
+		}
+	}
+	return Location{}, false
+}
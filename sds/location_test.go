@@ -0,0 +1,108 @@
+package sds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNMEALocation(t *testing.T) {
+	tt := []struct {
+		desc     string
+		value    string
+		expected Location
+		invalid  bool
+	}{
+		{
+			desc:     "GGA with checksum",
+			value:    "$GPGGA,123456.00,4901.2345,N,01012.3456,E,1,05,1.0,100.0,M,0.0,M,,*54",
+			expected: Location{Latitude: 49.020575, Longitude: 10.20576},
+		},
+		{
+			desc:     "GLL without checksum",
+			value:    "$GPGLL,4901.2345,S,01012.3456,W",
+			expected: Location{Latitude: -49.020575, Longitude: -10.20576},
+		},
+		{
+			desc:     "RMC",
+			value:    "$GNRMC,123456.00,A,4901.2345,N,01012.3456,E,0.0,0.0,110421,,,A",
+			expected: Location{Latitude: 49.020575, Longitude: 10.20576},
+		},
+		{
+			desc:    "wrong checksum",
+			value:   "$GPGLL,4901.2345,S,01012.3456,W*00",
+			invalid: true,
+		},
+		{
+			desc:    "unsupported type",
+			value:   "$GPGSV,1,1,00",
+			invalid: true,
+		},
+		{
+			desc:    "no NMEA",
+			value:   "testmessage",
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseNMEALocation(tc.value)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.expected.Latitude, actual.Latitude, 0.000001)
+			assert.InDelta(t, tc.expected.Longitude, actual.Longitude, 0.000001)
+		})
+	}
+}
+
+func TestConcatenatedTextSDU_Location(t *testing.T) {
+	nmea := "$GPGLL,4901.2345,S,01012.3456,W"
+	sdu := ConcatenatedTextSDU{
+		TextSDU: TextSDU{
+			TextHeader: TextHeader{
+				Encoding: ISO8859_1,
+			},
+			Text: "testmessage",
+		},
+		UserDataHeader: ConcatenatedTextUDH{
+			ElementID:        ConcatenatedTextMessageWithShortReference,
+			MessageReference: 0xC9,
+			TotalNumber:      2,
+			SequenceNumber:   1,
+			OtherElements: []UDHInformationElement{
+				{ID: 0x70, Data: []byte{0xFF}},
+				{ID: 0x71, Data: []byte(nmea)},
+			},
+		},
+	}
+
+	bytes, bits := sdu.Encode([]byte{}, 0)
+	require.Equal(t, sdu.Length(), len(bytes))
+	require.Equal(t, len(bytes)*8, bits)
+	assert.Equal(t, []byte{0x01, byte(5 + 3 + 2 + len(nmea)), 0x00, 0x03, 0xC9, 0x02, 0x01, 0x70, 0x01, 0xFF, 0x71, byte(len(nmea))}, bytes[0:12])
+
+	actual, err := ParseConcatenatedTextSDU(bytes)
+	require.NoError(t, err)
+	assert.Equal(t, "testmessage", actual.Text)
+	assert.Equal(t, uint16(0xC9), actual.UserDataHeader.MessageReference)
+	assert.Equal(t, sdu.UserDataHeader.OtherElements, actual.UserDataHeader.OtherElements)
+
+	location, ok := actual.Location()
+	assert.True(t, ok)
+	assert.InDelta(t, -49.020575, location.Latitude, 0.000001)
+	assert.InDelta(t, -10.20576, location.Longitude, 0.000001)
+}
+
+func TestConcatenatedTextSDU_NoLocation(t *testing.T) {
+	actual, err := ParseConcatenatedTextSDU([]byte{0x01, 0x08, 0x70, 0x01, 0xFF, 0x00, 0x03, 0xC9, 0x02, 0x01, 0x74, 0x65, 0x73, 0x74})
+	require.NoError(t, err)
+	assert.Equal(t, "test", actual.Text)
+	assert.Equal(t, byte(2), actual.UserDataHeader.TotalNumber)
+
+	_, ok := actual.Location()
+	assert.False(t, ok)
+}
@@ -0,0 +1,230 @@
+package sds
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ftl/tetra-pei/tetra"
+)
+
+// IndicationRegistry allows to register handlers for unsolicited indications, e.g. com.COM.
+type IndicationRegistry interface {
+	AddIndication(prefix string, trailingLines int, handler func(lines []string)) error
+}
+
+// ContinuationRegistry allows to register handlers for unsolicited indications that span a variable number of lines,
+// e.g. com.COM.
+type ContinuationRegistry interface {
+	AddIndicationUntil(prefix string, complete func(lines []string) bool, handler func(lines []string)) error
+}
+
+// ErrorCallback is called with errors that occur while incoming messages are processed.
+type ErrorCallback func(error)
+
+// Pipeline combines the processing of incoming messages in one place: parsing the +CTSDSR indications, reassembling
+// concatenated messages and sending the requested reports using a Stack, removing a leading OPTA and a trailing ITSI
+// from the text, and delivering the results to the callbacks. By default, OPTA and ITSI are removed.
+// A pipeline is safe to be used from the concurrent handlers of a com.COM.
+type Pipeline struct {
+	lock            sync.Mutex
+	stack           *Stack
+	stripOPTA       bool
+	stripITSI       bool
+	fallback        TextEncoding
+	parseOptions    []ParseOption
+	messageCallback MessageCallback
+	errorCallback   ErrorCallback
+}
+
+func NewPipeline() *Pipeline {
+	result := &Pipeline{
+		stack:     NewStack(),
+		stripOPTA: true,
+		stripITSI: true,
+		fallback:  DefaultFallbackEncoding,
+	}
+	result.stack.WithMessageCallback(result.deliver)
+	return result
+}
+
+// Stack returns the stack of this pipeline to configure the reassembly and the reports, e.g. with WithReportOptions
+// or WithRestartOnTotalMismatch. The message callback of the stack must not be replaced, use WithMessageCallback
+// of the pipeline instead.
+func (p *Pipeline) Stack() *Stack {
+	return p.stack
+}
+
+// WithOPTAStripping defines if a leading OPTA is removed from the text of the delivered messages.
+func (p *Pipeline) WithOPTAStripping(strip bool) *Pipeline {
+	p.stripOPTA = strip
+	return p
+}
+
+// WithITSIStripping defines if a trailing ITSI is removed from the text of the delivered messages.
+func (p *Pipeline) WithITSIStripping(strip bool) *Pipeline {
+	p.stripITSI = strip
+	return p
+}
+
+// WithFallbackEncoding sets the encoding that is used to decode texts with an unsupported encoding.
+// The default is DefaultFallbackEncoding.
+func (p *Pipeline) WithFallbackEncoding(fallback TextEncoding) *Pipeline {
+	p.fallback = fallback
+	return p
+}
+
+// WithParseOptions sets additional options to parse the incoming messages, e.g. WithCharacterCount.
+func (p *Pipeline) WithParseOptions(options ...ParseOption) *Pipeline {
+	p.parseOptions = options
+	return p
+}
+
+func (p *Pipeline) WithMessageCallback(callback MessageCallback) *Pipeline {
+	p.messageCallback = callback
+	return p
+}
+
+func (p *Pipeline) WithStatusCallback(callback StatusCallback) *Pipeline {
+	p.stack.WithStatusCallback(callback)
+	return p
+}
+
+func (p *Pipeline) WithReportCallback(callback ReportCallback) *Pipeline {
+	p.stack.WithReportCallback(callback)
+	return p
+}
+
+func (p *Pipeline) WithDataCallback(callback DataCallback) *Pipeline {
+	p.stack.WithDataCallback(callback)
+	return p
+}
+
+func (p *Pipeline) WithErrorCallback(callback ErrorCallback) *Pipeline {
+	p.errorCallback = callback
+	return p
+}
+
+// AttachTo registers the pipeline for the +CTSDSR indications at the given registry. The reports are sent
+// using the given requester. If the registry is also a ContinuationRegistry, the hex representation of the PDU
+// may span multiple continuation lines, otherwise it is expected on the single line following the header.
+func (p *Pipeline) AttachTo(ctx context.Context, registry IndicationRegistry, requester tetra.Requester) error {
+	p.stack.WithResponseCallback(func(commands []string) error {
+		_, err := SendParts(ctx, requester, commands)
+		if err != nil {
+			p.handleError(err)
+		}
+		return err
+	})
+
+	handler := func(lines []string) {
+		if len(lines) < 2 {
+			return
+		}
+		err := p.PutLines(lines[0], lines[1:]...)
+		if err != nil {
+			p.handleError(err)
+		}
+	}
+	if continuationRegistry, ok := registry.(ContinuationRegistry); ok {
+		return continuationRegistry.AddIndicationUntil("+CTSDSR:", pduComplete, handler)
+	}
+	return registry.AddIndication("+CTSDSR:", 1, handler)
+}
+
+// pduComplete indicates if the given lines of a +CTSDSR indication contain the complete hex representation of the PDU
+// announced in the header. A line with other characters than hex digits and whitespace, e.g. a trailing result code,
+// also completes the indication, as well as a header that cannot be parsed.
+func pduComplete(lines []string) bool {
+	if len(lines) < 2 {
+		return false
+	}
+	header, err := ParseHeader(lines[0])
+	if err != nil {
+		return true
+	}
+
+	hexDigits := 0
+	for _, line := range lines[1:] {
+		for _, c := range line {
+			switch {
+			case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+				hexDigits++
+			case c == ' ', c == '\t', c == '\r', c == '\n':
+			default:
+				return true
+			}
+		}
+	}
+	return hexDigits >= header.PDUBytes()*2
+}
+
+// PutLines processes the incoming message with the given header and a PDU whose hex representation spans
+// multiple continuation lines.
+func (p *Pipeline) PutLines(header string, pduLines ...string) error {
+	return p.Put(header, strings.Join(pduLines, ""))
+}
+
+// Put processes the incoming message with the given header and PDU.
+func (p *Pipeline) Put(header string, pdu string) error {
+	message, err := ParseIncomingMessageWithOptions(header, pdu, append([]ParseOption{WithFallback(p.fallback)}, p.parseOptions...)...)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.stack.Put(message)
+}
+
+func (p *Pipeline) deliver(message Message) {
+	if p.messageCallback == nil {
+		return
+	}
+	if len(message.parts) > 0 {
+		// OPTA and ITSI may span several parts, hence they are found in the complete text
+		parts := make([]part, len(message.parts))
+		copy(parts, message.parts)
+		text := message.Text()
+		if p.stripOPTA {
+			opta, _ := SplitLeadingOPTA(text)
+			trimPartsPrefix(parts, len(opta))
+		}
+		if p.stripITSI {
+			rest, _ := SplitTrailingITSI(text)
+			trimPartsSuffix(parts, len(text)-len(rest))
+		}
+		message.parts = parts
+	}
+	p.messageCallback(message)
+}
+
+// trimPartsPrefix removes the given number of bytes from the start of the text of the given parts.
+func trimPartsPrefix(parts []part, n int) {
+	for i := 0; i < len(parts) && n > 0; i++ {
+		l := len(parts[i].Text)
+		if l > n {
+			l = n
+		}
+		parts[i].Text = parts[i].Text[l:]
+		n -= l
+	}
+}
+
+// trimPartsSuffix removes the given number of bytes from the end of the text of the given parts.
+func trimPartsSuffix(parts []part, n int) {
+	for i := len(parts) - 1; i >= 0 && n > 0; i-- {
+		l := len(parts[i].Text)
+		if l > n {
+			l = n
+		}
+		parts[i].Text = parts[i].Text[:len(parts[i].Text)-l]
+		n -= l
+	}
+}
+
+func (p *Pipeline) handleError(err error) {
+	if p.errorCallback != nil {
+		p.errorCallback(err)
+	}
+}
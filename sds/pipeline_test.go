@@ -0,0 +1,196 @@
+package sds
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ftl/tetra-pei/com"
+	"github.com/ftl/tetra-pei/tetra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline_MultiPartMessageThroughCOM(t *testing.T) {
+	text := "LEITSTELLE#2620011234567890Einsatz am Marktplatz, bitte melden\x1a\x002620011234567891"
+	transfers := NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, 256, text)
+	require.Greater(t, len(transfers), 1)
+
+	device := com.NewInMemory()
+	defer device.Close()
+	radio := com.New(device)
+
+	messages := make(chan Message, 1)
+	pipeline := NewPipeline().
+		WithMessageCallback(func(m Message) {
+			messages <- m
+		}).
+		WithErrorCallback(func(err error) {
+			t.Error(err)
+		})
+	err := pipeline.AttachTo(context.Background(), radio, radio)
+	require.NoError(t, err)
+
+	for _, transfer := range transfers {
+		pdu, bits := transfer.Encode(nil, 0)
+		device.PrepareRead([]byte(fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d\r\n%s\r\n", bits, tetra.BinaryToHex(pdu))))
+	}
+
+	select {
+	case message := <-messages:
+		assert.Equal(t, tetra.Identity("1234567"), message.Source)
+		assert.Equal(t, tetra.Identity("2345678"), message.Destination)
+		assert.Equal(t, "Einsatz am Marktplatz, bitte melden", message.Text())
+	case <-time.After(time.Second):
+		t.Error("no message received")
+	}
+}
+
+func TestPipeline_ParseOptions(t *testing.T) {
+	var message Message
+	pipeline := NewPipeline().
+		WithParseOptions(WithCharacterCount()).
+		WithMessageCallback(func(m Message) {
+			message = m
+		})
+
+	err := pipeline.Put("+CTSDSR: 12,1234567,0,2345678,0,88", "8200C9010474657374")
+
+	require.NoError(t, err)
+	assert.Equal(t, "test", message.Text())
+}
+
+func TestPipeline_UnsupportedService(t *testing.T) {
+	var data DataMessage
+	pipeline := NewPipeline().
+		WithParseOptions(WithUnsupportedServices(SDS1Service)).
+		WithDataCallback(func(d DataMessage) {
+			data = d
+		})
+
+	err := pipeline.Put("+CTSDSR: 9,1234567,0,2345678,0,16", "1234")
+
+	require.NoError(t, err)
+	assert.Equal(t, UnsupportedServiceMessage{Service: SDS1Service, Raw: []byte{0x12, 0x34}}, data.Payload)
+
+	err = NewPipeline().Put("+CTSDSR: 9,1234567,0,2345678,0,16", "1234")
+	assert.Error(t, err)
+}
+
+func TestPipeline_ContinuationLinesThroughCOM(t *testing.T) {
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "a message with a long PDU")
+	pdu, bits := transfer.Encode(nil, 0)
+	pduHex := tetra.BinaryToHex(pdu)
+
+	device := com.NewInMemory()
+	defer device.Close()
+	radio := com.New(device)
+
+	messages := make(chan Message, 2)
+	pipeline := NewPipeline().
+		WithMessageCallback(func(m Message) {
+			messages <- m
+		}).
+		WithErrorCallback(func(err error) {
+			t.Error(err)
+		})
+	err := pipeline.AttachTo(context.Background(), radio, radio)
+	require.NoError(t, err)
+
+	device.PrepareRead([]byte(fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d\r\n%s\r\n%s\r\n%s\r\n", bits, pduHex[:20], pduHex[20:40], pduHex[40:])))
+	device.PrepareRead([]byte(fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d\r\n%s\r\n", bits, pduHex)))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case message := <-messages:
+			assert.Equal(t, "a message with a long PDU", message.Text())
+		case <-time.After(time.Second):
+			t.Errorf("message %d not received", i)
+		}
+	}
+}
+
+func TestPDUComplete(t *testing.T) {
+	tt := []struct {
+		desc     string
+		lines    []string
+		expected bool
+	}{
+		{desc: "header only", lines: []string{"+CTSDSR: 12,1234567,0,2345678,0,32"}},
+		{desc: "single line", lines: []string{"+CTSDSR: 12,1234567,0,2345678,0,32", "821000C9"}, expected: true},
+		{desc: "first continuation line", lines: []string{"+CTSDSR: 12,1234567,0,2345678,0,32", "8210"}},
+		{desc: "continuation lines", lines: []string{"+CTSDSR: 12,1234567,0,2345678,0,32", "8210", "00C9"}, expected: true},
+		{desc: "not byte aligned", lines: []string{"+CTSDSR: 12,1234567,0,2345678,0,28", "821000C0"}, expected: true},
+		{desc: "trailing result code", lines: []string{"+CTSDSR: 12,1234567,0,2345678,0,32", "8210 OK"}, expected: true},
+		{desc: "invalid header", lines: []string{"+CTSDSR: invalid", "8210"}, expected: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, pduComplete(tc.lines))
+		})
+	}
+}
+
+func TestPipeline_Stripping(t *testing.T) {
+	text := "LEITSTELLE#2620011234567890testmessage\x0d\x0d2620011234567891"
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, text)
+	pdu, bits := transfer.Encode(nil, 0)
+	header := fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d", bits)
+
+	tt := []struct {
+		desc      string
+		stripOPTA bool
+		stripITSI bool
+		expected  string
+	}{
+		{desc: "both", stripOPTA: true, stripITSI: true, expected: "testmessage"},
+		{desc: "only OPTA", stripOPTA: true, expected: "testmessage\x0d\x0d2620011234567891"},
+		{desc: "only ITSI", stripITSI: true, expected: "LEITSTELLE#2620011234567890testmessage"},
+		{desc: "none", expected: text},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			var message Message
+			pipeline := NewPipeline().
+				WithOPTAStripping(tc.stripOPTA).
+				WithITSIStripping(tc.stripITSI).
+				WithMessageCallback(func(m Message) {
+					message = m
+				})
+
+			err := pipeline.Put(header, tetra.BinaryToHex(pdu))
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, message.Text())
+		})
+	}
+}
+
+func TestPipeline_FallbackEncoding(t *testing.T) {
+	pdu := fmt.Sprintf("8200C9%02X74657374E4", byte(VISCII))
+	header := "+CTSDSR: 12,1234567,0,2345678,0,72"
+
+	tt := []struct {
+		desc      string
+		configure func(*Pipeline) *Pipeline
+		expected  string
+	}{
+		{desc: "default", configure: func(p *Pipeline) *Pipeline { return p }, expected: "testä"},
+		{desc: "CP437", configure: func(p *Pipeline) *Pipeline { return p.WithFallbackEncoding(CodePage437) }, expected: "testΣ"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			var message Message
+			pipeline := tc.configure(NewPipeline()).
+				WithMessageCallback(func(m Message) {
+					message = m
+				})
+
+			err := pipeline.Put(header, pdu)
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, message.Text())
+		})
+	}
+}
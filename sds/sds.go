@@ -3,6 +3,8 @@ package sds
 import (
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,13 +15,89 @@ import (
 // ParseIncomingMessage parses an incoming message with the given header and PDU bytes. The message may
 // be part of a concatenated text message with user data header, a simple text message, a text message,
 // or a status.
+// The hex representation of the PDU may use upper or lower case and contain whitespace. A trailing final
+// result code (OK or ERROR) is ignored.
 func ParseIncomingMessage(headerString string, pduHex string) (IncomingMessage, error) {
+	return ParseIncomingMessageWithFallback(headerString, pduHex, DefaultFallbackEncoding)
+}
+
+// ParseIncomingMessageWithFallback works like ParseIncomingMessage, but decodes texts with an unsupported
+// encoding using the given fallback encoding instead of DefaultFallbackEncoding.
+func ParseIncomingMessageWithFallback(headerString string, pduHex string, fallback TextEncoding) (IncomingMessage, error) {
+	return ParseIncomingMessageWithOptions(headerString, pduHex, WithFallback(fallback))
+}
+
+// ParseOption configures how the PDU of an incoming message is parsed.
+type ParseOption func(*parseConfig)
+
+type parseConfig struct {
+	fallback            TextEncoding
+	lazyText            bool
+	characterCount      bool
+	unsupportedServices []AIService
+}
+
+func (c parseConfig) acceptsUnsupported(service AIService) bool {
+	for _, s := range c.unsupportedServices {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+func newParseConfig(options []ParseOption) parseConfig {
+	result := parseConfig{
+		fallback: DefaultFallbackEncoding,
+	}
+	for _, option := range options {
+		option(&result)
+	}
+	return result
+}
+
+// WithFallback sets the encoding that is used to decode texts with an unsupported encoding.
+// The default is DefaultFallbackEncoding.
+func WithFallback(fallback TextEncoding) ParseOption {
+	return func(c *parseConfig) {
+		c.fallback = fallback
+	}
+}
+
+// WithLazyText defers the decoding of the text of text messages: the user data of an SDS-TRANSFER
+// for text messaging is parsed into a LazyTextSDU instead of a TextSDU.
+func WithLazyText() ParseOption {
+	return func(c *parseConfig) {
+		c.lazyText = true
+	}
+}
+
+// WithCharacterCount expects the text header of text messages to carry the number of characters
+// (see ParseTextHeaderWithCharacterCount). The text is limited to this number of characters.
+func WithCharacterCount() ParseOption {
+	return func(c *parseConfig) {
+		c.characterCount = true
+	}
+}
+
+// WithUnsupportedServices lets the parser return an UnsupportedServiceMessage for incoming messages with one of
+// the given AI services instead of an error. Use this to log or route messages of services like SDS-1 or SDS-2
+// without failing the whole parse.
+func WithUnsupportedServices(services ...AIService) ParseOption {
+	return func(c *parseConfig) {
+		c.unsupportedServices = append(c.unsupportedServices, services...)
+	}
+}
+
+// ParseIncomingMessageWithOptions works like ParseIncomingMessage, but parses the PDU with the given options.
+func ParseIncomingMessageWithOptions(headerString string, pduHex string, options ...ParseOption) (IncomingMessage, error) {
+	config := newParseConfig(options)
 	header, err := ParseHeader(headerString)
 	if err != nil {
 		return IncomingMessage{}, err
 	}
 
-	pduBytes, err := tetra.HexToBinary(pduHex)
+	pduBytes, err := tetra.HexToBinary(trailingResultCode.ReplaceAllString(pduHex, ""))
 	if err != nil {
 		return IncomingMessage{}, fmt.Errorf("cannot decode hex PDU data: %w", err)
 	}
@@ -34,11 +112,21 @@ func ParseIncomingMessage(headerString string, pduHex string) (IncomingMessage,
 	result.Header = header
 	switch header.AIService {
 	case SDSTLService:
-		result.Payload, err = ParseSDSTLPDU(pduBytes)
+		if sdsTLProtocolSupported(pduBytes) {
+			result.Payload, err = parseSDSTLPDU(pduBytes, header.PDUBits, config)
+		} else {
+			result.Payload, err = ParseSDS4(pduBytes)
+		}
 	case StatusService:
 		result.Payload, err = ParseStatus(pduBytes)
 	default:
-		return IncomingMessage{}, fmt.Errorf("AI service %s is not supported", header.AIService)
+		if !config.acceptsUnsupported(header.AIService) {
+			return IncomingMessage{}, fmt.Errorf("AI service %s is not supported", header.AIService)
+		}
+		result.Payload = UnsupportedServiceMessage{
+			Service: header.AIService,
+			Raw:     pduBytes,
+		}
 	}
 
 	if err != nil {
@@ -47,11 +135,45 @@ func ParseIncomingMessage(headerString string, pduHex string) (IncomingMessage,
 	return result, nil
 }
 
+// trailingResultCode matches a final result code that some radios glue to the end of the PDU's hex representation.
+// Since the result codes contain characters that are no hex digits, they cannot be confused with the PDU.
+var trailingResultCode = regexp.MustCompile(`(?i)\s*(OK|ERROR)\s*$`)
+
+// ParseIncomingMessageLines parses an incoming message with the given header and a PDU whose hex representation
+// spans multiple continuation lines. The lines are joined before the PDU is decoded.
+func ParseIncomingMessageLines(headerString string, pduLines ...string) (IncomingMessage, error) {
+	return ParseIncomingMessage(headerString, strings.Join(pduLines, ""))
+}
+
+// ParseLoggedMessage parses an incoming message from a single line of a captured radio log. The line must contain
+// the +CTSDSR: header, followed by the hex representation of the PDU. Header and PDU may be separated by whitespace,
+// line breaks (also escaped as \r\n or \n), "|" or ";". Anything in front of the header, e.g. a timestamp, is ignored.
+func ParseLoggedMessage(line string) (IncomingMessage, error) {
+	start := strings.Index(line, "+CTSDSR:")
+	if start == -1 {
+		return IncomingMessage{}, fmt.Errorf("no +CTSDSR header found: %s", line)
+	}
+	parts := loggedMessageExpression.FindStringSubmatch(line[start:])
+	if len(parts) != 3 {
+		return IncomingMessage{}, fmt.Errorf("no PDU found after the +CTSDSR header: %s", line)
+	}
+	return ParseIncomingMessage(parts[1], parts[2])
+}
+
+var loggedMessageExpression = regexp.MustCompile(`^(\+CTSDSR:.*?,\s*\d+)(?:\\r|\\n|[\s|;])+([0-9A-Fa-f]+)(?:(?:\\r|\\n|\s)*(?i:OK))?\s*$`)
+
 type IncomingMessage struct {
 	Header  Header
 	Payload interface{}
 }
 
+// UnsupportedServiceMessage is the payload of an incoming message with an AI service that is not supported by
+// ParseIncomingMessage, but was accepted with the WithUnsupportedServices option. It contains the raw PDU bytes.
+type UnsupportedServiceMessage struct {
+	Service AIService
+	Raw     []byte
+}
+
 // ParseHeader from the given string. The string must include the +CTSDSR: token.
 func ParseHeader(s string) (Header, error) {
 	if !strings.HasPrefix(s, "+CTSDSR:") {
@@ -60,18 +182,41 @@ func ParseHeader(s string) (Header, error) {
 
 	var result Header
 	headerFields := strings.Split(s[8:], ",")
-	switch len(headerFields) {
-	case 3, 4: // minimum set
+	fieldCount := len(headerFields)
+	switch {
+	case fieldCount == 3, fieldCount == 4: // minimum set
 		result.AIService = AIService(strings.TrimSpace(headerFields[0]))
 		result.Destination = tetra.Identity(strings.TrimSpace(headerFields[1]))
-	case 6, 7: // with source, with end-to-end encryption
+		if fieldCount == 4 {
+			destinationType, err := tetra.ParseIdentityType(headerFields[2])
+			if err != nil {
+				return Header{}, fmt.Errorf("invalid destination identity type: %v", err)
+			}
+			result.DestinationType = destinationType
+		}
+	case fieldCount == 6, fieldCount == 7, fieldCount == 8, fieldCount == 9:
+		// with source, with end-to-end encryption, with calling party subaddress, with one additional field
 		result.AIService = AIService(strings.TrimSpace(headerFields[0]))
 		result.Source = tetra.Identity(strings.TrimSpace(headerFields[1]))
 		result.Destination = tetra.Identity(strings.TrimSpace(headerFields[3]))
+		sourceType, err := tetra.ParseIdentityType(headerFields[2])
+		if err != nil {
+			return Header{}, fmt.Errorf("invalid source identity type: %v", err)
+		}
+		result.SourceType = sourceType
+		destinationType, err := tetra.ParseIdentityType(headerFields[4])
+		if err != nil {
+			return Header{}, fmt.Errorf("invalid destination identity type: %v", err)
+		}
+		result.DestinationType = destinationType
+		if fieldCount == 8 || fieldCount == 9 {
+			result.CallingPartySubaddress = strings.TrimSpace(headerFields[6])
+		}
 	default:
-		return Header{}, fmt.Errorf("invalid header, wrong field count: %s", s)
+		return Header{}, &HeaderFormatError{Fields: fieldCount, Raw: s}
 	}
 
+	// the length is always the last field
 	pduBitCountField := headerFields[len(headerFields)-1]
 	var err error
 	result.PDUBits, err = strconv.Atoi(strings.TrimSpace(pduBitCountField))
@@ -82,6 +227,16 @@ func ParseHeader(s string) (Header, error) {
 	return result, nil
 }
 
+// HeaderFormatError indicates that a +CTSDSR header has an unexpected number of fields.
+type HeaderFormatError struct {
+	Fields int
+	Raw    string
+}
+
+func (e *HeaderFormatError) Error() string {
+	return fmt.Sprintf("invalid header, wrong field count %d: %s", e.Fields, e.Raw)
+}
+
 // Header represents the information provided with the AT+CTSDSR unsolicited response indicating an incoming SDS.
 // see [PEI] 6.13.3
 type Header struct {
@@ -89,6 +244,13 @@ type Header struct {
 	Source      tetra.Identity
 	Destination tetra.Identity
 	PDUBits     int
+
+	// SourceType and DestinationType are the identity types reported with the source and destination identities.
+	SourceType      tetra.IdentityType
+	DestinationType tetra.IdentityType
+
+	// CallingPartySubaddress is only provided by some networks in an extended form of the header.
+	CallingPartySubaddress string
 }
 
 // PDUBytes returns the size of the following PDU in bytes.
@@ -105,9 +267,10 @@ type AIService string
 
 // All AI services relevant for SDS handling, according to [PEI] 6.17.3
 const (
-	SDS1Service   AIService = "9"
-	SDS2Service   AIService = "10"
-	SDS3Service   AIService = "11"
+	SDS1Service AIService = "9"
+	SDS2Service AIService = "10"
+	SDS3Service AIService = "11"
+	// SDSTLService is SDS type 4, which carries the SDS-TL PDUs as well as PDUs of other protocols (see SDS4Message).
 	SDSTLService  AIService = "12"
 	StatusService AIService = "13"
 )
@@ -127,6 +290,16 @@ func (p ProtocolIdentifier) Length() int {
 	return 1
 }
 
+// Immediate indicates if messages with this protocol identifier should be displayed/handled immediately by the TE.
+func (p ProtocolIdentifier) Immediate() bool {
+	switch p {
+	case SimpleImmediateTextMessaging, ImmediateTextMessaging:
+		return true
+	default:
+		return false
+	}
+}
+
 // All protocol identifiers relevant for SDS handling, according to [AI] table 29.21
 const (
 	SimpleTextMessaging            ProtocolIdentifier = 0x02
@@ -138,28 +311,109 @@ const (
 	ConcatenatedSDSMessaging       ProtocolIdentifier = 0x8C
 )
 
+// ProtocolIdentifierByName allows to access all defined protocol identifiers by their name as string.
+var ProtocolIdentifierByName = map[string]ProtocolIdentifier{
+	"SimpleTextMessaging":            SimpleTextMessaging,
+	"SimpleImmediateTextMessaging":   SimpleImmediateTextMessaging,
+	"SimpleConcatenatedSDSMessaging": SimpleConcatenatedSDSMessaging,
+	"TextMessaging":                  TextMessaging,
+	"ImmediateTextMessaging":         ImmediateTextMessaging,
+	"UserDataHeaderMessaging":        UserDataHeaderMessaging,
+	"ConcatenatedSDSMessaging":       ConcatenatedSDSMessaging,
+}
+
+var protocolIdentifierNames = func() map[ProtocolIdentifier]string {
+	result := make(map[ProtocolIdentifier]string, len(ProtocolIdentifierByName))
+	for name, p := range ProtocolIdentifierByName {
+		result[p] = name
+	}
+	return result
+}()
+
+// String returns the name of this protocol identifier, or its hex value if it is unknown.
+func (p ProtocolIdentifier) String() string {
+	name, ok := protocolIdentifierNames[p]
+	if !ok {
+		return fmt.Sprintf("0x%02x", byte(p))
+	}
+	return name
+}
+
+// supportsEmptyTransfer indicates if a SDS-TRANSFER PDU with this protocol may come without any SDU.
+func (p ProtocolIdentifier) supportsEmptyTransfer() bool {
+	switch p {
+	case TextMessaging, ImmediateTextMessaging, UserDataHeaderMessaging:
+		return true
+	default:
+		return false
+	}
+}
+
 /* SDS-TL related types and functions */
 
 // ParseSDSTLPDU parses an SDS-TL PDU from the given bytes according to [AI] 29.4.1.
 // This function currently supports only a subset of the possible protocol identifiers:
-// Simple text messaging (0x02), simple immediate text messaging (0x09), text messaging (0x82),
+// Simple text messaging (0x02), simple immediate text messaging (0x09), simple concatenated SDS messaging (0x0C), text messaging (0x82),
 // immediate text messaging (0x89), message with user data header (0x8A)
 func ParseSDSTLPDU(bytes []byte) (interface{}, error) {
+	return parseSDSTLPDU(bytes, len(bytes)*8, newParseConfig(nil))
+}
+
+// parseSDSTLPDU parses an SDS-TL PDU with the given number of meaningful bits using the given configuration.
+func parseSDSTLPDU(bytes []byte, bits int, config parseConfig) (interface{}, error) {
 	if len(bytes) == 0 {
 		return nil, fmt.Errorf("empty payload")
 	}
 
-	switch ProtocolIdentifier(bytes[0]) {
-	case SimpleTextMessaging, SimpleImmediateTextMessaging:
-		return ParseSimpleTextMessage(bytes)
-	case TextMessaging, ImmediateTextMessaging, UserDataHeaderMessaging:
-		return parseSDSTLMessage(bytes)
-	default:
-		return nil, fmt.Errorf("protocol 0x%x not supported", bytes[0])
+	parse, ok := sdsTLParsers[ProtocolIdentifier(bytes[0])]
+	if !ok {
+		return nil, fmt.Errorf("protocol %s not supported", ProtocolIdentifier(bytes[0]))
 	}
+	return parse(bytes, bits, config)
 }
 
-func parseSDSTLMessage(bytes []byte) (interface{}, error) {
+// sdsTLProtocolSupported indicates if the protocol identifier of the given SDS type 4 PDU is supported by ParseSDSTLPDU.
+// An empty PDU is left to ParseSDSTLPDU to report the error.
+func sdsTLProtocolSupported(bytes []byte) bool {
+	if len(bytes) == 0 {
+		return true
+	}
+	_, ok := sdsTLParsers[ProtocolIdentifier(bytes[0])]
+	return ok
+}
+
+type sdsTLParser func(bytes []byte, bits int, config parseConfig) (interface{}, error)
+
+func parseSimpleTextMessagePayload(bytes []byte, bits int, config parseConfig) (interface{}, error) {
+	return parseSimpleTextMessage(bytes, bits, config.fallback)
+}
+
+func parseSimpleConcatenatedTextMessagePayload(bytes []byte, bits int, config parseConfig) (interface{}, error) {
+	return parseSimpleConcatenatedTextMessage(bytes, bits, config.fallback)
+}
+
+var sdsTLParsers = map[ProtocolIdentifier]sdsTLParser{
+	SimpleTextMessaging:            parseSimpleTextMessagePayload,
+	SimpleImmediateTextMessaging:   parseSimpleTextMessagePayload,
+	SimpleConcatenatedSDSMessaging: parseSimpleConcatenatedTextMessagePayload,
+	TextMessaging:                  parseSDSTLMessage,
+	ImmediateTextMessaging:         parseSDSTLMessage,
+	UserDataHeaderMessaging:        parseSDSTLMessage,
+}
+
+// SupportedProtocols returns the protocol identifiers that are supported by ParseSDSTLPDU, in ascending order.
+func SupportedProtocols() []ProtocolIdentifier {
+	result := make([]ProtocolIdentifier, 0, len(sdsTLParsers))
+	for protocol := range sdsTLParsers {
+		result = append(result, protocol)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
+
+func parseSDSTLMessage(bytes []byte, bits int, config parseConfig) (interface{}, error) {
 	if len(bytes) < 2 {
 		return nil, fmt.Errorf("payload too short: %d", len(bytes))
 	}
@@ -167,7 +421,7 @@ func parseSDSTLMessage(bytes []byte) (interface{}, error) {
 	messageType := SDSTLMessageType(bytes[1] >> 4)
 	switch messageType {
 	case SDSTransferMessage:
-		return ParseSDSTransfer(bytes)
+		return parseSDSTransfer(bytes, bits, config)
 	case SDSReportMessage:
 		return ParseSDSReport(bytes)
 	case SDSAcknowledgeMessage:
@@ -209,11 +463,67 @@ type SDSAcknowledge struct {
 	MessageReference MessageReference
 }
 
-// ParseSDSReport parses a SDS-REPORT PDU from the given bytes
+// NewSDSAcknowledge returns a new SDS-ACK PDU that acknowledges the given SDS-REPORT with the given delivery status.
+func NewSDSAcknowledge(sdsReport SDSReport, deliveryStatus DeliveryStatus) SDSAcknowledge {
+	return SDSAcknowledge{
+		protocol:         sdsReport.protocol,
+		DeliveryStatus:   deliveryStatus,
+		MessageReference: sdsReport.MessageReference,
+	}
+}
+
+// Encode this SDS-ACK PDU
+func (a SDSAcknowledge) Encode(bytes []byte, bits int) ([]byte, int) {
+	bytes, bits = a.protocol.Encode(bytes, bits)
+
+	bytes = append(bytes, byte(SDSAcknowledgeMessage)<<4)
+	bits += 8
+
+	bytes, bits = a.DeliveryStatus.Encode(bytes, bits)
+	bytes, bits = a.MessageReference.Encode(bytes, bits)
+
+	return bytes, bits
+}
+
+// Report is implemented by SDSReport and SDSShortReport to handle both forms of reports uniformly.
+type Report interface {
+	Encoder
+	// Reference returns the message reference of the reported message.
+	Reference() MessageReference
+	// Status returns the reported delivery status.
+	Status() DeliveryStatus
+	// Short indicates if this is a SDS-SHORT-REPORT.
+	Short() bool
+}
+
+// ParseReport parses either a SDS-SHORT-REPORT or a SDS-REPORT PDU from the given bytes, depending on the PDU identifier.
+func ParseReport(bytes []byte) (Report, error) {
+	if len(bytes) == 2 && (bytes[0]&SDSShortReportPDUIdentifier) == SDSShortReportPDUIdentifier {
+		shortReport, err := ParseSDSShortReport(bytes)
+		if err != nil {
+			return nil, err
+		}
+		return shortReport, nil
+	}
+
+	report, err := ParseSDSReport(bytes)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ParseSDSReport parses a SDS-REPORT PDU from the given bytes.
+// According to [AI] 29.4.2.2, a SDS-REPORT carries exactly one delivery status. If the receipt and the consumption
+// of a message are both reported, the radio sends two separate SDS-REPORT PDUs.
 func ParseSDSReport(bytes []byte) (SDSReport, error) {
 	if len(bytes) < 4 {
 		return SDSReport{}, fmt.Errorf("SDS-REPORT PDU too short: %d", len(bytes))
 	}
+	messageType := SDSTLMessageType(bytes[1] >> 4)
+	if messageType != SDSReportMessage {
+		return SDSReport{}, fmt.Errorf("SDS-REPORT PDU invalid message type 0x%x", messageType)
+	}
 
 	var result SDSReport
 
@@ -233,6 +543,9 @@ func ParseSDSReport(bytes []byte) (SDSReport, error) {
 		result.StoreForwardControl = sfc
 		userdataStart += sfc.Length()
 	}
+	if userdataStart > len(bytes) {
+		return SDSReport{}, fmt.Errorf("SDS-REPORT PDU too short for store/forward control: need %d bytes, got %d", userdataStart, len(bytes))
+	}
 
 	if userdataStart < len(bytes) {
 		result.UserData = bytes[userdataStart:]
@@ -251,7 +564,26 @@ func NewSDSReport(sdsTransfer SDSTransfer, ackRequired bool, deliveryStatus Deli
 	}
 }
 
-// SDSReport represents the SDS-REPORT PDU contents as defined in [AI] 29.4.2.2
+// BuildReport creates the report for the given SDS-TRANSFER PDU with the given delivery status. It returns a SDS-SHORT-REPORT
+// if the sender selected the short form report and the status can be expressed as short report, otherwise a SDS-REPORT.
+// The second return value indicates if the result is a short report.
+func BuildReport(sdsTransfer SDSTransfer, deliveryStatus DeliveryStatus) (Encoder, bool) {
+	return buildReport(sdsTransfer, false, deliveryStatus)
+}
+
+func buildReport(sdsTransfer SDSTransfer, ackRequired bool, deliveryStatus DeliveryStatus) (Encoder, bool) {
+	reportType, ok := deliveryStatus.ShortReportType()
+	if !sdsTransfer.ServiceSelectionShortFormReport || !ok {
+		return NewSDSReport(sdsTransfer, ackRequired, deliveryStatus), false
+	}
+	return SDSShortReport{
+		ReportType:       reportType,
+		MessageReference: sdsTransfer.MessageReference,
+	}, true
+}
+
+// SDSReport represents the SDS-REPORT PDU contents as defined in [AI] 29.4.2.2.
+// Each report contains only one delivery status, reports for receipt and consumption are sent separately.
 type SDSReport struct {
 	protocol            ProtocolIdentifier
 	AckRequired         bool
@@ -264,6 +596,21 @@ type SDSReport struct {
 	UserData []byte
 }
 
+// Reference returns the message reference of the reported message.
+func (r SDSReport) Reference() MessageReference {
+	return r.MessageReference
+}
+
+// Status returns the reported delivery status.
+func (r SDSReport) Status() DeliveryStatus {
+	return r.DeliveryStatus
+}
+
+// Short returns false, a SDS-REPORT is the long form of a report.
+func (r SDSReport) Short() bool {
+	return false
+}
+
 // Encode this SDS-REPORT PDU
 func (r SDSReport) Encode(bytes []byte, bits int) ([]byte, int) {
 	bytes, bits = r.protocol.Encode(bytes, bits)
@@ -308,6 +655,37 @@ type SDSShortReport struct {
 	MessageReference MessageReference
 }
 
+// DeliveryStatus returns the delivery status that corresponds to the report type of this short report.
+func (r SDSShortReport) DeliveryStatus() DeliveryStatus {
+	switch r.ReportType {
+	case ProtocolOrEncodingNotSupportedShort:
+		return ProtocolNotSupported
+	case DestinationMemoryFullShort:
+		return DestinationMemoryFull
+	case MessageReceivedShort:
+		return ReceiptAckByDestination
+	case MessageConsumedShort:
+		return ConsumedByDestination
+	default:
+		return DeliveryFailed
+	}
+}
+
+// Reference returns the message reference of the reported message.
+func (r SDSShortReport) Reference() MessageReference {
+	return r.MessageReference
+}
+
+// Status returns the delivery status that corresponds to the report type of this short report.
+func (r SDSShortReport) Status() DeliveryStatus {
+	return r.DeliveryStatus()
+}
+
+// Short returns true, a SDS-SHORT-REPORT is the short form of a report.
+func (r SDSShortReport) Short() bool {
+	return true
+}
+
 // Encode this SDS-SHORT-REPORT PDU
 func (r SDSShortReport) Encode(bytes []byte, bits int) ([]byte, int) {
 	byte0 := byte(0x7C) | byte(r.ReportType)
@@ -321,7 +699,16 @@ func (r SDSShortReport) Encode(bytes []byte, bits int) ([]byte, int) {
 
 // ParseSDSTransfer parses a SDS-TRANSFER PDU from the given bytes
 func ParseSDSTransfer(bytes []byte) (SDSTransfer, error) {
-	if len(bytes) < 4 {
+	return parseSDSTransfer(bytes, len(bytes)*8, newParseConfig(nil))
+}
+
+// ParseSDSTransferWithOptions works like ParseSDSTransfer, but parses the user data with the given options.
+func ParseSDSTransferWithOptions(bytes []byte, options ...ParseOption) (SDSTransfer, error) {
+	return parseSDSTransfer(bytes, len(bytes)*8, newParseConfig(options))
+}
+
+func parseSDSTransfer(bytes []byte, bits int, config parseConfig) (SDSTransfer, error) {
+	if len(bytes) < 3 {
 		return SDSTransfer{}, fmt.Errorf("SDS-TRANSFER PDU too short: %d", len(bytes))
 	}
 
@@ -343,17 +730,29 @@ func ParseSDSTransfer(bytes []byte) (SDSTransfer, error) {
 		result.StoreForwardControl = sfc
 		userdataStart += sfc.Length()
 	}
+	if userdataStart > len(bytes) {
+		return SDSTransfer{}, fmt.Errorf("SDS-TRANSFER PDU too short for store/forward control: need %d bytes, got %d", userdataStart, len(bytes))
+	}
 
 	var sdu interface{}
 	var err error
 
+	if len(bytes) == userdataStart && result.protocol.supportsEmptyTransfer() {
+		// a SDS-TRANSFER without SDU, e.g. a keep-alive
+		return result, nil
+	}
+
 	switch result.protocol {
 	case TextMessaging, ImmediateTextMessaging:
-		sdu, err = ParseTextSDU(bytes[userdataStart:])
+		if config.lazyText {
+			sdu, err = parseLazyTextSDU(bytes[userdataStart:], bits-userdataStart*8, config)
+		} else {
+			sdu, err = parseTextSDU(bytes[userdataStart:], bits-userdataStart*8, config)
+		}
 	case UserDataHeaderMessaging:
-		sdu, err = ParseConcatenatedTextSDU(bytes[userdataStart:])
+		sdu, err = parseConcatenatedTextSDU(bytes[userdataStart:], bits-userdataStart*8, config.fallback)
 	default:
-		return SDSTransfer{}, fmt.Errorf("protocol 0x%x is not supported as SDS-TRANSFER content", bytes[0])
+		return SDSTransfer{}, fmt.Errorf("protocol %s is not supported as SDS-TRANSFER content", result.protocol)
 	}
 
 	if err != nil {
@@ -386,18 +785,56 @@ func NewTextMessageTransfer(messageReference MessageReference, immediate bool, d
 	}
 }
 
+// NewStoreForwardTextTransfer returns a new SDS-TRANSFER PDU for text messaging that requests store and forward delivery
+// to the given forward address with the given validity period.
+func NewStoreForwardTextTransfer(messageReference MessageReference, forwardAddress ForwardAddressSSI, validity ValidityPeriod, encoding TextEncoding, text string) SDSTransfer {
+	result := NewTextMessageTransfer(messageReference, false, NoReportRequested, encoding, text)
+	result.StoreForwardControl = StoreForwardControl{
+		Valid:              true,
+		ValidityPeriod:     validity,
+		ForwardAddressType: ForwardToSSI,
+		ForwardAddressSSI:  forwardAddress,
+	}
+	return result
+}
+
+// NewStoreForwardExternalTransfer returns a new SDS-TRANSFER PDU for text messaging that requests store and forward delivery
+// to the given external subscriber number with the given validity period.
+func NewStoreForwardExternalTransfer(messageReference MessageReference, number string, validity ValidityPeriod, encoding TextEncoding, text string) (SDSTransfer, error) {
+	externalNumber, err := ParseExternalSubscriberNumber(number)
+	if err != nil {
+		return SDSTransfer{}, err
+	}
+	result := NewTextMessageTransfer(messageReference, false, NoReportRequested, encoding, text)
+	result.StoreForwardControl = StoreForwardControl{
+		Valid:                    true,
+		ValidityPeriod:           validity,
+		ForwardAddressType:       ForwardToExternalSubscriberNumber,
+		ExternalSubscriberNumber: externalNumber,
+	}
+	return result, nil
+}
+
 // NewConcatenatedMessageTransfer returns a set of SDS_TRANSFER PDUs for that make up the given text using concatenated text messages with a UDH.
 func NewConcatenatedMessageTransfer(messageReference MessageReference, deliveryReport DeliveryReportRequest, encoding TextEncoding, maxPDUBits int, text string) []SDSTransfer {
+	return newConcatenatedMessageTransfer(messageReference, deliveryReport, NewTextHeader(encoding), maxPDUBits, text)
+}
+
+// NewConcatenatedMessageTransferWithTimestamp works like NewConcatenatedMessageTransfer, but includes the given timestamp
+// in every part. The space needed for the timestamp is taken into account when the text is split.
+func NewConcatenatedMessageTransferWithTimestamp(messageReference MessageReference, deliveryReport DeliveryReportRequest, encoding TextEncoding, timestamp time.Time, maxPDUBits int, text string) []SDSTransfer {
+	return newConcatenatedMessageTransfer(messageReference, deliveryReport, NewTextHeaderWithTimestamp(encoding, timestamp), maxPDUBits, text)
+}
+
+func newConcatenatedMessageTransfer(messageReference MessageReference, deliveryReport DeliveryReportRequest, header TextHeader, maxPDUBits int, text string) []SDSTransfer {
 	blueprint := SDSTransfer{
 		protocol:              UserDataHeaderMessaging,
 		MessageReference:      messageReference,
 		DeliveryReportRequest: deliveryReport,
 		UserData: ConcatenatedTextSDU{
 			TextSDU: TextSDU{
-				TextHeader: TextHeader{
-					Encoding: encoding,
-				},
-				Text: "",
+				TextHeader: header,
+				Text:       "",
 			},
 			UserDataHeader: ConcatenatedTextUDH{
 				ElementID:        ConcatenatedTextMessageWithShortReference,
@@ -409,7 +846,7 @@ func NewConcatenatedMessageTransfer(messageReference MessageReference, deliveryR
 	}
 	blueprintBits := blueprint.Length() * 8
 
-	textParts := SplitToMaxBits(encoding, maxPDUBits-blueprintBits, text)
+	textParts := SplitToMaxBits(header.Encoding, maxPDUBits-blueprintBits, text)
 
 	if len(textParts) == 1 {
 		return []SDSTransfer{{
@@ -417,10 +854,8 @@ func NewConcatenatedMessageTransfer(messageReference MessageReference, deliveryR
 			MessageReference:      messageReference,
 			DeliveryReportRequest: deliveryReport,
 			UserData: TextSDU{
-				TextHeader: TextHeader{
-					Encoding: encoding,
-				},
-				Text: text,
+				TextHeader: header,
+				Text:       text,
 			},
 		}}
 	}
@@ -430,14 +865,12 @@ func NewConcatenatedMessageTransfer(messageReference MessageReference, deliveryR
 		result[i] = SDSTransfer{
 			protocol:                        UserDataHeaderMessaging,
 			ServiceSelectionShortFormReport: true,
-			MessageReference:                messageReference + MessageReference(i),
+			MessageReference:                messageReference.Offset(i),
 			DeliveryReportRequest:           deliveryReport,
 			UserData: ConcatenatedTextSDU{
 				TextSDU: TextSDU{
-					TextHeader: TextHeader{
-						Encoding: encoding,
-					},
-					Text: textPart,
+					TextHeader: header,
+					Text:       textPart,
 				},
 				UserDataHeader: ConcatenatedTextUDH{
 					ElementID:        ConcatenatedTextMessageWithShortReference,
@@ -462,6 +895,26 @@ type SDSTransfer struct {
 	UserData                        interface{}
 }
 
+// WithTimestamp returns a copy of this SDS-TRANSFER PDU whose text header carries the given timestamp.
+// The timestamp adds 3 bytes to the PDU. PDUs without text and the parts of a concatenated message are returned
+// unchanged, since the additional bytes may exceed the maximum size of the parts. Use
+// NewConcatenatedMessageTransferWithTimestamp to split a message into parts that carry a timestamp.
+func (m SDSTransfer) WithTimestamp(timestamp time.Time) SDSTransfer {
+	sdu, ok := m.UserData.(TextSDU)
+	if !ok {
+		return m
+	}
+	sdu.HasTimestamp = true
+	sdu.Timestamp = timestamp
+	m.UserData = sdu
+	return m
+}
+
+// WithCurrentTimestamp returns a copy of this SDS-TRANSFER PDU whose text header carries the current time as timestamp.
+func (m SDSTransfer) WithCurrentTimestamp() SDSTransfer {
+	return m.WithTimestamp(time.Now())
+}
+
 // Encode this SDS-TRANSFER PDU
 func (m SDSTransfer) Encode(bytes []byte, bits int) ([]byte, int) {
 	bytes, bits = m.protocol.Encode(bytes, bits)
@@ -472,10 +925,16 @@ func (m SDSTransfer) Encode(bytes []byte, bits int) ([]byte, int) {
 	if !m.ServiceSelectionShortFormReport {
 		byte1 |= 0x02
 	}
+	if m.StoreForwardControl.Valid {
+		byte1 |= 0x01
+	}
 	bytes = append(bytes, byte1)
 	bits += 8
 
 	bytes, bits = m.MessageReference.Encode(bytes, bits)
+	if m.StoreForwardControl.Valid {
+		bytes, bits = m.StoreForwardControl.Encode(bytes, bits)
+	}
 
 	switch sdu := m.UserData.(type) {
 	case TextSDU:
@@ -487,12 +946,30 @@ func (m SDSTransfer) Encode(bytes []byte, bits int) ([]byte, int) {
 	return bytes, bits
 }
 
+// EncodedBits returns the exact number of bits of this encoded SDS-TRANSFER PDU, as given to AT+CMGS.
+func (m SDSTransfer) EncodedBits() int {
+	result := (m.protocol.Length() + 2) * 8 // protocol, byte1, message reference
+	if m.StoreForwardControl.Valid {
+		result += m.StoreForwardControl.Length() * 8
+	}
+	switch sdu := m.UserData.(type) {
+	case TextSDU:
+		result += sdu.EncodedBits()
+	case ConcatenatedTextSDU:
+		result += sdu.EncodedBits()
+	}
+	return result
+}
+
 // Length of this SDS-TRANSFER in bytes.
 func (m SDSTransfer) Length() int {
 	var result int
 	result += m.protocol.Length()
 	result++ // byte1
 	result++ // message reference
+	if m.StoreForwardControl.Valid {
+		result += m.StoreForwardControl.Length()
+	}
 	switch sdu := m.UserData.(type) {
 	case TextSDU:
 		result += sdu.Length()
@@ -516,12 +993,20 @@ func (m SDSTransfer) ConsumedReportRequested() bool {
 
 // Immediate indiciates if this message should be displayed/handled immediately by the TE.
 func (m SDSTransfer) Immediate() bool {
-	return m.protocol == ImmediateTextMessaging
+	return m.protocol.Immediate()
 }
 
 // MessageReference according to [AI] 29.4.3.7
 type MessageReference byte
 
+// Offset returns the message reference that lies the given number of references after this message reference.
+// The result wraps around within 0-255. The parts of a concatenated message use consecutive references starting at
+// the message's reference, hence the following message should use Offset(len(parts)) as its reference to avoid
+// reusing a reference that is still in flight.
+func (m MessageReference) Offset(n int) MessageReference {
+	return MessageReference((int(m) + n) & 0xFF)
+}
+
 // Encode this message reference
 func (m MessageReference) Encode(bytes []byte, bits int) ([]byte, int) {
 	return append(bytes, byte(m)), bits + 8
@@ -560,6 +1045,32 @@ func (s DeliveryStatus) EndToEndControl() bool {
 	return (s & 0xE0) == 0x80
 }
 
+// Retryable indicates if sending the message again could succeed after this status was reported. This is true for
+// temporary errors and for failures that are caused by a temporary condition of the network or the destination,
+// e.g. network overload or a full memory. Permanent failures like an unsupported protocol or a destination that
+// is not authorized are not retryable.
+func (s DeliveryStatus) Retryable() bool {
+	if s.TemporaryError() {
+		return true
+	}
+	switch s {
+	case NetworkOverload,
+		ServiceTemporaryNotAvailable,
+		DestinationNotRegistered,
+		DestinationQueueFull,
+		DestinationHostNotConnected,
+		DestinationMemoryFullMessageDiscarded,
+		DestinationNotReachable,
+		NotAllConcatenationPartsReceived,
+		DestinationEngagedInAnotherServiceBySwMI,
+		DestinationEngagedInAnotherServiceByDest,
+		DestinationMemoryFull:
+		return true
+	default:
+		return false
+	}
+}
+
 // All DeliveryStatus values according to [AI] table 29.16
 const (
 	// Success
@@ -625,6 +1136,23 @@ const (
 	StartSending DeliveryStatus = 0x81
 )
 
+// ShortReportType returns the short report type that expresses this delivery status. The second return value is false
+// if this delivery status cannot be expressed in a SDS-SHORT-REPORT.
+func (s DeliveryStatus) ShortReportType() (ShortReportType, bool) {
+	switch s {
+	case ProtocolNotSupported, DataCodingSchemeNotSupported:
+		return ProtocolOrEncodingNotSupportedShort, true
+	case DestinationMemoryFull:
+		return DestinationMemoryFullShort, true
+	case ReceiptAckByDestination:
+		return MessageReceivedShort, true
+	case ConsumedByDestination:
+		return MessageConsumedShort, true
+	default:
+		return 0, false
+	}
+}
+
 // ShortReportType enum according to [AI] 29.4.3.10
 type ShortReportType byte
 
@@ -656,7 +1184,7 @@ func ParseStoreForwardControl(bytes []byte) (StoreForwardControl, error) {
 
 	result.Valid = true
 	result.ValidityPeriod = ParseValidityPeriod(bytes[0] >> 3)
-	result.ForwardAddressType = ForwardAddressType(bytes[0] & 3)
+	result.ForwardAddressType = ForwardAddressType(bytes[0] & 0x07)
 
 	switch result.ForwardAddressType {
 	case ForwardToSNA:
@@ -670,10 +1198,11 @@ func ParseStoreForwardControl(bytes []byte) (StoreForwardControl, error) {
 		}
 		copy(result.ForwardAddressSSI[:], bytes[1:4])
 	case ForwardToTSI:
-		if len(bytes) < 4 {
+		if len(bytes) < 7 {
 			return StoreForwardControl{}, fmt.Errorf("store forward control with TSI too short: %d", len(bytes))
 		}
 		copy(result.ForwardAddressSSI[:], bytes[1:4])
+		copy(result.ForwardAddressExtension[:], bytes[4:7])
 	case ForwardToExternalSubscriberNumber:
 		if len(bytes) < 2 {
 			return StoreForwardControl{}, fmt.Errorf("store forward control with external subscriber number too short: %d", len(bytes))
@@ -687,13 +1216,13 @@ func ParseStoreForwardControl(bytes []byte) (StoreForwardControl, error) {
 			return StoreForwardControl{}, fmt.Errorf("store forward control with external subscriber number too short: %d", len(bytes))
 		}
 
-		result.ExternalSubscriberNumber = make(ExternalSubscriberNumber, 0, l)
+		result.ExternalSubscriberNumber = make(ExternalSubscriberNumber, l)
 		d := 0
-		for i := 0; i < bl; i++ {
+		for i := 2; i < 2+bl; i++ {
 			result.ExternalSubscriberNumber[d] = ExternalSubscriberNumberDigit(bytes[i] >> 4)
 			d++
 			if d < l {
-				result.ExternalSubscriberNumber[d+1] = ExternalSubscriberNumberDigit(bytes[i] & 0x0F)
+				result.ExternalSubscriberNumber[d] = ExternalSubscriberNumberDigit(bytes[i] & 0x0F)
 				d++
 			}
 		}
@@ -722,7 +1251,7 @@ func (s StoreForwardControl) Length() int {
 	case ForwardToSSI:
 		return 4
 	case ForwardToTSI:
-		return 4
+		return 7
 	case ForwardToExternalSubscriberNumber:
 		l := len(s.ExternalSubscriberNumber) / 2
 		if len(s.ExternalSubscriberNumber)%2 > 0 {
@@ -736,13 +1265,56 @@ func (s StoreForwardControl) Length() int {
 	}
 }
 
+// Encode this store forward control
+func (s StoreForwardControl) Encode(bytes []byte, bits int) ([]byte, int) {
+	validityPeriod, _ := s.ValidityPeriod.Encode()
+	bytes = append(bytes, (validityPeriod[0]<<3)|(byte(s.ForwardAddressType)&0x07))
+	bits += 8
+
+	switch s.ForwardAddressType {
+	case ForwardToSNA:
+		bytes = append(bytes, byte(s.ForwardAddressSNA))
+		bits += 8
+	case ForwardToSSI:
+		bytes = append(bytes, s.ForwardAddressSSI[:]...)
+		bits += 24
+	case ForwardToTSI:
+		bytes = append(bytes, s.ForwardAddressSSI[:]...)
+		bytes = append(bytes, s.ForwardAddressExtension[:]...)
+		bits += 48
+	case ForwardToExternalSubscriberNumber:
+		bytes = append(bytes, byte(len(s.ExternalSubscriberNumber)))
+		bits += 8
+		for i := 0; i < len(s.ExternalSubscriberNumber); i += 2 {
+			b := byte(s.ExternalSubscriberNumber[i]) << 4
+			if i+1 < len(s.ExternalSubscriberNumber) {
+				b |= byte(s.ExternalSubscriberNumber[i+1]) & 0x0F
+			}
+			bytes = append(bytes, b)
+			bits += 8
+		}
+	}
+
+	return bytes, bits
+}
+
 // ValidityPeriod according to [AI] 29.4.3.14
 type ValidityPeriod time.Duration
 
 // InfinitelyValid represents the infinite validity period (31).
 const InfinitelyValid ValidityPeriod = -1
 
-// DecodeValidityPeriod from a 5 bits value according to [AI] table 29.25
+// ParseValidityPeriod from a 5 bits value according to [AI] table 29.25.
+// The canonical durations for each code are:
+//
+//	0:      no validity period
+//	1-6:    10 seconds steps, 10s to 60s
+//	7-10:   1 minute steps, 2min to 5min
+//	11-16:  10 minutes steps, 10min to 60min
+//	17-21:  1 hour steps, 2h to 6h
+//	22-24:  6 hours steps, 12h to 24h
+//	25-30:  48 hours steps, 2d to 12d
+//	31:     infinite (InfinitelyValid)
 func ParseValidityPeriod(b byte) ValidityPeriod {
 	switch {
 	case b == 0:
@@ -764,7 +1336,8 @@ func ParseValidityPeriod(b byte) ValidityPeriod {
 	}
 }
 
-// Encode the validity period into 5 bits, according to [AI] table 29.25
+// Encode the validity period into 5 bits, according to [AI] table 29.25. Durations that are not representable
+// are rounded up to the next canonical duration (see ParseValidityPeriod).
 func (p ValidityPeriod) Encode() ([]byte, int) {
 	d := time.Duration(p)
 	var result byte
@@ -776,7 +1349,9 @@ func (p ValidityPeriod) Encode() ([]byte, int) {
 	}
 
 	switch {
-	case d == 0:
+	case p == InfinitelyValid:
+		return []byte{31}, 8
+	case d <= 0:
 		return []byte{0}, 8
 	case d <= time.Minute:
 		result = byte(int(d.Truncate(time.Second).Seconds() / 10))
@@ -825,6 +1400,11 @@ type ForwardAddressSNA byte
 // ForwardAddressSSI according to [AI] 29.4.3.6
 type ForwardAddressSSI [3]byte
 
+// NewForwardAddressSSI returns the forward address for the given 24 bit SSI.
+func NewForwardAddressSSI(ssi uint32) ForwardAddressSSI {
+	return ForwardAddressSSI{byte(ssi >> 16), byte(ssi >> 8), byte(ssi)}
+}
+
 // ForwardAddressExtendsion according to [AI] 29.4.3.6
 type ForwardAddressExtension [3]byte
 
@@ -834,10 +1414,103 @@ type ExternalSubscriberNumber []ExternalSubscriberNumberDigit
 // ExternalSubscriberNumberDigit represents one digit in the ExternalSubscriberNumber
 type ExternalSubscriberNumberDigit byte // its only 4 bits per digit
 
+// externalSubscriberNumberCharacters maps the digit values of an external subscriber number to their characters.
+const externalSubscriberNumberCharacters = "0123456789*#+"
+
+// ParseExternalSubscriberNumber parses the given dialable number into an external subscriber number.
+// Allowed are the digits 0-9 and the characters *, #, and +.
+func ParseExternalSubscriberNumber(s string) (ExternalSubscriberNumber, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty external subscriber number")
+	}
+	if len(s) > 255 {
+		return nil, fmt.Errorf("external subscriber number too long: %d", len(s))
+	}
+	result := make(ExternalSubscriberNumber, len(s))
+	for i, c := range []byte(s) {
+		digit := strings.IndexByte(externalSubscriberNumberCharacters, c)
+		if digit == -1 {
+			return nil, fmt.Errorf("invalid character %q in external subscriber number %s", c, s)
+		}
+		result[i] = ExternalSubscriberNumberDigit(digit)
+	}
+	return result, nil
+}
+
+func (n ExternalSubscriberNumber) String() string {
+	result := make([]byte, len(n))
+	for i, digit := range n {
+		if int(digit) < len(externalSubscriberNumberCharacters) {
+			result[i] = externalSubscriberNumberCharacters[digit]
+		} else {
+			result[i] = '?'
+		}
+	}
+	return string(result)
+}
+
+/* SDS type 4 related types and functions */
+
+// ParseSDS4 parses a SDS type 4 PDU that consists only of the protocol identifier and
+// the protocol specific data, without any SDS-TL header.
+func ParseSDS4(bytes []byte) (SDS4Message, error) {
+	if len(bytes) < 1 {
+		return SDS4Message{}, fmt.Errorf("SDS type 4 PDU too short: %d", len(bytes))
+	}
+
+	var result SDS4Message
+	result.protocol = ProtocolIdentifier(bytes[0])
+	if len(bytes) > 1 {
+		result.Data = append([]byte{}, bytes[1:]...)
+	}
+
+	return result, nil
+}
+
+// NewSDS4Message returns a new SDS type 4 PDU with the given protocol identifier and data.
+func NewSDS4Message(protocol ProtocolIdentifier, data []byte) SDS4Message {
+	return SDS4Message{
+		protocol: protocol,
+		Data:     data,
+	}
+}
+
+// SDS4Message represents a SDS type 4 PDU that carries only the protocol identifier and the protocol specific data, see [AI] 14.8.52.
+// ParseIncomingMessage returns a SDS4Message for PDUs of the SDS type 4 service (SDSTLService) with a protocol identifier
+// that is not supported by ParseSDSTLPDU. SDS type 3 (SDS3Service) carries fixed length user data without a protocol
+// identifier and is not parsed as SDS4Message.
+type SDS4Message struct {
+	protocol ProtocolIdentifier
+	Data     []byte
+}
+
+// Protocol returns the protocol identifier of this message.
+func (m SDS4Message) Protocol() ProtocolIdentifier {
+	return m.protocol
+}
+
+// Encode this SDS type 4 message
+func (m SDS4Message) Encode(bytes []byte, bits int) ([]byte, int) {
+	bytes, bits = m.protocol.Encode(bytes, bits)
+	bytes = append(bytes, m.Data...)
+	bits += len(m.Data) * 8
+
+	return bytes, bits
+}
+
+// Length returns the length of this encoded message in bytes.
+func (m SDS4Message) Length() int {
+	return m.protocol.Length() + len(m.Data)
+}
+
 /* Simple Text Messaging related types and functions */
 
 // ParseSimpleTextMessage parses a simple text message PDU
 func ParseSimpleTextMessage(bytes []byte) (SimpleTextMessage, error) {
+	return parseSimpleTextMessage(bytes, len(bytes)*8, DefaultFallbackEncoding)
+}
+
+func parseSimpleTextMessage(bytes []byte, bits int, fallback TextEncoding) (SimpleTextMessage, error) {
 	if len(bytes) < 2 {
 		return SimpleTextMessage{}, fmt.Errorf("simple text message PDU too short: %d", len(bytes))
 	}
@@ -846,7 +1519,7 @@ func ParseSimpleTextMessage(bytes []byte) (SimpleTextMessage, error) {
 	result.protocol = ProtocolIdentifier(bytes[0])
 	result.Encoding = TextEncoding(bytes[1] & 0x7F)
 
-	text, err := DecodePayloadText(result.Encoding, bytes[2:])
+	text, err := decodePayloadText(result.Encoding, bytes[2:], bits-16, fallbackCodecFor(fallback))
 	if err != nil {
 		return SimpleTextMessage{}, err
 	}
@@ -859,9 +1532,9 @@ func ParseSimpleTextMessage(bytes []byte) (SimpleTextMessage, error) {
 func NewSimpleTextMessage(immediate bool, encoding TextEncoding, text string) SimpleTextMessage {
 	var protocol ProtocolIdentifier
 	if immediate {
-		protocol = ImmediateTextMessaging
+		protocol = SimpleImmediateTextMessaging
 	} else {
-		protocol = TextMessaging
+		protocol = SimpleTextMessaging
 	}
 
 	return SimpleTextMessage{
@@ -880,7 +1553,7 @@ type SimpleTextMessage struct {
 
 // Immediate indiciates if this message should be displayed/handled immediately by the TE.
 func (m SimpleTextMessage) Immediate() bool {
-	return m.protocol == SimpleImmediateTextMessaging
+	return m.protocol.Immediate()
 }
 
 // Encode this simple text message
@@ -893,26 +1566,184 @@ func (m SimpleTextMessage) Encode(bytes []byte, bits int) ([]byte, int) {
 	return bytes, bits
 }
 
+/* Simple concatenated text messaging related types and functions */
+
+// ParseSimpleConcatenatedTextMessage parses a part of a concatenated simple text message.
+func ParseSimpleConcatenatedTextMessage(bytes []byte) (SimpleConcatenatedTextMessage, error) {
+	return parseSimpleConcatenatedTextMessage(bytes, len(bytes)*8, DefaultFallbackEncoding)
+}
+
+func parseSimpleConcatenatedTextMessage(bytes []byte, bits int, fallback TextEncoding) (SimpleConcatenatedTextMessage, error) {
+	/*
+		Example PDU: 0CC9020101746573746D65737361676531
+
+		0C: Protocol Identifier[8]
+		C9: Message Reference[8] (0xC9) <-- This is always the message reference of the first part
+		02: Total number of parts[8] (2)
+		01: Sequence number of current part[8] (1) <-- 1-based, first part == 1
+		01: Reserved[1], Text Encoding Scheme[7] (ISO8859-1)
+
+		and then comes the text data
+	*/
+	if len(bytes) < 5 {
+		return SimpleConcatenatedTextMessage{}, fmt.Errorf("simple concatenated text message PDU too short: %d", len(bytes))
+	}
+
+	var result SimpleConcatenatedTextMessage
+	result.protocol = ProtocolIdentifier(bytes[0])
+	result.MessageReference = MessageReference(bytes[1])
+	result.TotalNumber = bytes[2]
+	result.SequenceNumber = bytes[3]
+	result.Encoding = TextEncoding(bytes[4] & 0x7F)
+
+	text, err := decodePayloadText(result.Encoding, bytes[5:], bits-40, fallbackCodecFor(fallback))
+	if err != nil {
+		return SimpleConcatenatedTextMessage{}, err
+	}
+	result.Text = text
+
+	return result, nil
+}
+
+// NewSimpleConcatenatedTextMessages returns the parts of a concatenated simple text message. The text is split
+// into parts that do not exceed the given maximum number of PDU bits.
+func NewSimpleConcatenatedTextMessages(messageReference MessageReference, encoding TextEncoding, maxPDUBits int, text string) []SimpleConcatenatedTextMessage {
+	blueprint := SimpleConcatenatedTextMessage{protocol: SimpleConcatenatedSDSMessaging}
+	textParts := SplitToMaxBits(encoding, maxPDUBits-blueprint.Length()*8, text)
+
+	result := make([]SimpleConcatenatedTextMessage, len(textParts))
+	for i, textPart := range textParts {
+		result[i] = SimpleConcatenatedTextMessage{
+			protocol:         SimpleConcatenatedSDSMessaging,
+			MessageReference: messageReference,
+			TotalNumber:      byte(len(textParts)),
+			SequenceNumber:   byte(i + 1),
+			Encoding:         encoding,
+			Text:             textPart,
+		}
+	}
+	return result
+}
+
+// SimpleConcatenatedTextMessage represents one part of a concatenated simple text message.
+type SimpleConcatenatedTextMessage struct {
+	protocol         ProtocolIdentifier
+	MessageReference MessageReference
+	TotalNumber      byte
+	SequenceNumber   byte
+	Encoding         TextEncoding
+	Text             string
+}
+
+// Encode this part of a concatenated simple text message
+func (m SimpleConcatenatedTextMessage) Encode(bytes []byte, bits int) ([]byte, int) {
+	bytes, bits = m.protocol.Encode(bytes, bits)
+	bytes, bits = m.MessageReference.Encode(bytes, bits)
+	bytes = append(bytes, m.TotalNumber, m.SequenceNumber, byte(m.Encoding))
+	bits += 24
+	bytes, bits = AppendEncodedPayloadText(bytes, bits, m.Text, m.Encoding)
+
+	return bytes, bits
+}
+
+// Length returns the length of this encoded part in bytes.
+func (m SimpleConcatenatedTextMessage) Length() int {
+	return m.protocol.Length() + 4 + TextBytes(m.Encoding, len(m.Text))
+}
+
 /* Text messaging related types and functions */
 
 // ParseTextSDU parses the user data of a text message.
 func ParseTextSDU(bytes []byte) (TextSDU, error) {
-	textHeader, err := ParseTextHeader(bytes)
+	return parseTextSDU(bytes, len(bytes)*8, newParseConfig(nil))
+}
+
+// ParseTextSDUWithFallback works like ParseTextSDU, but decodes a text with an unsupported encoding
+// using the given fallback encoding instead of DefaultFallbackEncoding.
+func ParseTextSDUWithFallback(bytes []byte, fallback TextEncoding) (TextSDU, error) {
+	return parseTextSDU(bytes, len(bytes)*8, newParseConfig([]ParseOption{WithFallback(fallback)}))
+}
+
+func parseTextSDU(bytes []byte, bits int, config parseConfig) (TextSDU, error) {
+	textHeader, err := config.parseTextHeader(bytes)
 	if err != nil {
 		return TextSDU{}, err
 	}
 	textPayloadStart := textHeader.Length()
-	text, err := DecodePayloadText(textHeader.Encoding, bytes[textPayloadStart:])
+	text, err := decodePayloadText(textHeader.Encoding, bytes[textPayloadStart:], bits-textPayloadStart*8, fallbackCodecFor(config.fallback))
 	if err != nil {
 		return TextSDU{}, err
 	}
 
 	return TextSDU{
 		TextHeader: textHeader,
+		Text:       textHeader.limitText(text),
+	}, nil
+}
+
+func (c parseConfig) parseTextHeader(bytes []byte) (TextHeader, error) {
+	if c.characterCount {
+		return ParseTextHeaderWithCharacterCount(bytes)
+	}
+	return ParseTextHeader(bytes)
+}
+
+// ParseLazyTextSDU parses the header of a text message's user data, but defers the decoding of the text
+// until LazyTextSDU.DecodeText is called. This is useful if most messages are filtered before their text is needed.
+func ParseLazyTextSDU(bytes []byte) (LazyTextSDU, error) {
+	return parseLazyTextSDU(bytes, len(bytes)*8, newParseConfig(nil))
+}
+
+func parseLazyTextSDU(bytes []byte, bits int, config parseConfig) (LazyTextSDU, error) {
+	textHeader, err := config.parseTextHeader(bytes)
+	if err != nil {
+		return LazyTextSDU{}, err
+	}
+	textPayloadStart := textHeader.Length()
+
+	return LazyTextSDU{
+		TextHeader: textHeader,
+		RawText:    bytes[textPayloadStart:],
+		rawBits:    bits - textPayloadStart*8,
+		fallback:   config.fallback,
+	}, nil
+}
+
+// LazyTextSDU contains the user data of a text message with the still encoded text.
+type LazyTextSDU struct {
+	TextHeader
+	RawText  []byte
+	rawBits  int
+	fallback TextEncoding
+}
+
+// DecodeText decodes the text of this SDU.
+func (t LazyTextSDU) DecodeText() (string, error) {
+	text, err := decodePayloadText(t.Encoding, t.RawText, t.rawBits, fallbackCodecFor(t.fallback))
+	if err != nil {
+		return "", err
+	}
+	return t.limitText(text), nil
+}
+
+// TextSDU decodes the text and returns the equivalent eagerly decoded TextSDU.
+func (t LazyTextSDU) TextSDU() (TextSDU, error) {
+	text, err := t.DecodeText()
+	if err != nil {
+		return TextSDU{}, err
+	}
+	return TextSDU{
+		TextHeader: t.TextHeader,
 		Text:       text,
 	}, nil
 }
 
+// ParseTextSDUWithCharacterCount parses the user data of a text message whose text header carries
+// the number of characters (see ParseTextHeaderWithCharacterCount). The text is limited to this number of characters.
+func ParseTextSDUWithCharacterCount(bytes []byte) (TextSDU, error) {
+	return parseTextSDU(bytes, len(bytes)*8, newParseConfig([]ParseOption{WithCharacterCount()}))
+}
+
 // TextSDU according to [AI] 29.5.3.3
 type TextSDU struct {
 	TextHeader
@@ -932,10 +1763,19 @@ func (t TextSDU) Length() int {
 	return t.TextHeader.Length() + TextBytes(t.Encoding, len(t.Text))
 }
 
+// EncodedBits returns the exact number of bits of this encoded text SDU.
+func (t TextSDU) EncodedBits() int {
+	return t.TextHeader.Length()*8 + EncodedPayloadTextBits(t.Text, t.Encoding)
+}
+
 /* Concatenated text messageing related types and functions */
 
 // ParseConcatenatedTextSDU parses the user data of a message with user data header.
 func ParseConcatenatedTextSDU(bytes []byte) (ConcatenatedTextSDU, error) {
+	return parseConcatenatedTextSDU(bytes, len(bytes)*8, DefaultFallbackEncoding)
+}
+
+func parseConcatenatedTextSDU(bytes []byte, bits int, fallback TextEncoding) (ConcatenatedTextSDU, error) {
 	/*
 		Example PDU with User Data Header: 8A00C98D045A8F050003C90201
 
@@ -967,7 +1807,7 @@ func ParseConcatenatedTextSDU(bytes []byte) (ConcatenatedTextSDU, error) {
 	}
 
 	textPayloadStart := udhStart + udh.Length()
-	text, err := DecodePayloadText(textHeader.Encoding, bytes[textPayloadStart:])
+	text, err := decodePayloadText(textHeader.Encoding, bytes[textPayloadStart:], bits-textPayloadStart*8, fallbackCodecFor(fallback))
 	if err != nil {
 		return ConcatenatedTextSDU{}, err
 	}
@@ -1001,7 +1841,13 @@ func (t ConcatenatedTextSDU) Length() int {
 	return t.TextSDU.Length() + t.UserDataHeader.Length()
 }
 
-// ParseConcatenatedTextUDH according to [AI] table 29.48
+// EncodedBits returns the exact number of bits of this encoded concatenated text SDU.
+func (t ConcatenatedTextSDU) EncodedBits() int {
+	return t.TextSDU.EncodedBits() + t.UserDataHeader.Length()*8
+}
+
+// ParseConcatenatedTextUDH according to [AI] table 29.48. Information elements other than the concatenation
+// information element are collected in OtherElements.
 func ParseConcatenatedTextUDH(bytes []byte) (ConcatenatedTextUDH, error) {
 	if len(bytes) < 6 {
 		return ConcatenatedTextUDH{}, fmt.Errorf("concatenated text UDH too short: %d", len(bytes))
@@ -1010,26 +1856,57 @@ func ParseConcatenatedTextUDH(bytes []byte) (ConcatenatedTextUDH, error) {
 	var result ConcatenatedTextUDH
 
 	result.HeaderLength = bytes[0]
-	result.ElementID = UDHInformationElementID(bytes[1])
-	result.ElementLength = bytes[2]
-	numbersStart := 4
-	if result.ElementID == ConcatenatedTextMessageWithShortReference {
-		if result.ElementLength != 3 {
-			return ConcatenatedTextUDH{}, fmt.Errorf("UDH information element length invalid, got %d but expected 3", result.ElementLength)
+	headerEnd := 1 + int(result.HeaderLength)
+	if len(bytes) < headerEnd {
+		return ConcatenatedTextUDH{}, fmt.Errorf("concatenated text UDH too short: %d, expected %d", len(bytes), headerEnd)
+	}
+
+	concatenationFound := false
+	for i := 1; i < headerEnd; {
+		if headerEnd-i < 2 {
+			return ConcatenatedTextUDH{}, fmt.Errorf("UDH information element at %d truncated", i)
 		}
-		result.MessageReference = uint16(bytes[3])
-	} else {
-		if result.ElementLength != 4 {
-			return ConcatenatedTextUDH{}, fmt.Errorf("UDH information element length invalid, got %d but expected 4", result.ElementLength)
+		elementID := UDHInformationElementID(bytes[i])
+		elementLength := bytes[i+1]
+		dataStart := i + 2
+		dataEnd := dataStart + int(elementLength)
+		if dataEnd > headerEnd {
+			return ConcatenatedTextUDH{}, fmt.Errorf("UDH information element 0x%x exceeds the header: %d > %d", elementID, dataEnd, headerEnd)
 		}
-		if len(bytes) < 7 {
-			return ConcatenatedTextUDH{}, fmt.Errorf("concatenated text UDH with long reference too short: %d", len(bytes))
+		data := bytes[dataStart:dataEnd]
+		i = dataEnd
+
+		if concatenationFound || (elementID != ConcatenatedTextMessageWithShortReference && elementID != ConcatenatedTextMessageWithLongReference) {
+			result.OtherElements = append(result.OtherElements, UDHInformationElement{
+				ID:   elementID,
+				Data: append([]byte{}, data...),
+			})
+			continue
+		}
+
+		result.ElementID = elementID
+		result.ElementLength = elementLength
+		numbersStart := 1
+		if elementID == ConcatenatedTextMessageWithShortReference {
+			if elementLength != 3 {
+				return ConcatenatedTextUDH{}, fmt.Errorf("UDH information element length invalid, got %d but expected 3", elementLength)
+			}
+			result.MessageReference = uint16(data[0])
+		} else {
+			if elementLength != 4 {
+				return ConcatenatedTextUDH{}, fmt.Errorf("UDH information element length invalid, got %d but expected 4", elementLength)
+			}
+			numbersStart = 2
+			result.MessageReference = (uint16(data[1]) << 8) | uint16(data[0])
 		}
-		numbersStart = 5
-		result.MessageReference = (uint16(bytes[4]) << 8) | uint16(bytes[3])
+		result.TotalNumber = data[numbersStart]
+		result.SequenceNumber = data[numbersStart+1]
+		concatenationFound = true
+	}
+
+	if !concatenationFound {
+		return ConcatenatedTextUDH{}, fmt.Errorf("concatenated text UDH without concatenation information element")
 	}
-	result.TotalNumber = bytes[numbersStart]
-	result.SequenceNumber = bytes[numbersStart+1]
 
 	return result, nil
 }
@@ -1042,6 +1919,9 @@ type ConcatenatedTextUDH struct {
 	MessageReference uint16
 	TotalNumber      byte
 	SequenceNumber   byte
+
+	// OtherElements contains all information elements in the header besides the concatenation information element.
+	OtherElements []UDHInformationElement
 }
 
 // Encode this concatenated text UDH
@@ -1069,9 +1949,14 @@ func (h ConcatenatedTextUDH) Encode(bytes []byte, bits int) ([]byte, int) {
 	bytes = append(bytes, h.SequenceNumber)
 	bits += 8
 
-	bytes[headerLengthIndex] = byte(len(bytes) - headerLengthIndex - 1)
 	bytes[elementLengthIndex] = byte(len(bytes) - elementLengthIndex - 1)
 
+	for _, element := range h.OtherElements {
+		bytes, bits = element.Encode(bytes, bits)
+	}
+
+	bytes[headerLengthIndex] = byte(len(bytes) - headerLengthIndex - 1)
+
 	return bytes, bits
 }
 
@@ -1081,10 +1966,31 @@ func (h ConcatenatedTextUDH) Length() int {
 	if h.ElementID == ConcatenatedTextMessageWithLongReference {
 		result++
 	}
+	for _, element := range h.OtherElements {
+		result += element.Length()
+	}
 
 	return result
 }
 
+// UDHInformationElement represents a generic information element in a user data header according to [AI] 29.5.9.4
+type UDHInformationElement struct {
+	ID   UDHInformationElementID
+	Data []byte
+}
+
+// Encode this information element
+func (e UDHInformationElement) Encode(bytes []byte, bits int) ([]byte, int) {
+	bytes = append(bytes, byte(e.ID), byte(len(e.Data)))
+	bytes = append(bytes, e.Data...)
+	return bytes, bits + 8*e.Length()
+}
+
+// Length returns the length of this information element in bytes.
+func (e UDHInformationElement) Length() int {
+	return 2 + len(e.Data)
+}
+
 // UDHInformationElementID enum according to [AI] 29.5.9.4.1
 type UDHInformationElementID byte
 
@@ -1098,8 +2004,11 @@ const (
 
 // ParseStatus from the given bytes.
 func ParseStatus(bytes []byte) (interface{}, error) {
-	if len(bytes) < 2 {
+	switch len(bytes) {
+	case 0:
 		return 0, fmt.Errorf("status value too short: %v", bytes)
+	case 1: // some radios deliver 8-bit pre-coded status values
+		return Status(bytes[0]), nil
 	}
 
 	if (bytes[0] & SDSShortReportPDUIdentifier) == SDSShortReportPDUIdentifier {
@@ -1133,6 +2042,67 @@ func (s Status) Length() int {
 	return 2
 }
 
+// NewEmergencyStatus returns the pre-coded status that indicates an emergency.
+func NewEmergencyStatus() Status {
+	return StatusEmergency
+}
+
+// IsEmergency indicates if this status is the emergency status.
+func (s Status) IsEmergency() bool {
+	return s == StatusEmergency
+}
+
+// IsUserDefined indicates if this status is within the band of network/user specific pre-coded status values.
+func (s Status) IsUserDefined() bool {
+	return s >= firstUserDefinedStatus
+}
+
+// Sendable indicates if this status is allowed to be sent by a TE: either the emergency status or
+// a network/user specific status (see [AI] 14.8.34).
+func (s Status) Sendable() bool {
+	return s.IsEmergency() || s.IsUserDefined()
+}
+
+// IsRequest indicates if this status is within the band of status requests (Status0 to Status9).
+func (s Status) IsRequest() bool {
+	return s >= Status0 && s <= Status9
+}
+
+// IsResponse indicates if this status is within the band of status responses (StatusA to Statusu).
+func (s Status) IsResponse() bool {
+	return s >= StatusA && s <= Statusu
+}
+
+// Direction returns the direction of this status.
+func (s Status) Direction() StatusDirection {
+	switch {
+	case s.IsRequest():
+		return StatusRequest
+	case s.IsResponse():
+		return StatusResponse
+	default:
+		return UnknownStatusDirection
+	}
+}
+
+// StatusDirection indicates if a status is a request or a response.
+type StatusDirection byte
+
+// All status directions
+const (
+	UnknownStatusDirection StatusDirection = iota
+	StatusRequest
+	StatusResponse
+)
+
+// Standardized pre-coded status values and bands according to [AI] 14.8.34
+const (
+	// StatusEmergency is the only standardized pre-coded status value, all other values below 0x8000 are reserved.
+	StatusEmergency Status = 0x0000
+
+	firstUserDefinedStatus Status = 0x8000
+)
+
 // Some relevant status values
 const (
 	// requests
@@ -1181,6 +2151,35 @@ func DecodeTimestamp(bytes []byte) (time.Time, error) {
 	return time.Date(year, time.Month(month), day, hour, minute, 0, 0, location), nil
 }
 
+// DecodeTimestampUTC works like DecodeTimestamp, but converts the decoded time to UTC, taking the timeframe type into account.
+func DecodeTimestampUTC(bytes []byte) (time.Time, error) {
+	timestamp, err := DecodeTimestamp(bytes)
+	if err != nil {
+		return timestamp, err
+	}
+	return timestamp.UTC(), nil
+}
+
+// DecodeTimestampRelativeTo works like DecodeTimestamp, but takes the year from the given reference time instead of the host's clock.
+func DecodeTimestampRelativeTo(bytes []byte, reference time.Time) (time.Time, error) {
+	timestamp, err := DecodeTimestamp(bytes)
+	if err != nil {
+		return timestamp, err
+	}
+	return TimestampRelativeTo(timestamp, reference), nil
+}
+
+// TimestampRelativeTo returns the given decoded timestamp with the year of the given reference time. Since a timestamp
+// according to [AI] 29.5.4.4 does not contain the year, a timestamp that lies more than one day after the reference
+// time is moved into the previous year (e.g. a message from December that is received in January).
+func TimestampRelativeTo(timestamp time.Time, reference time.Time) time.Time {
+	result := time.Date(reference.Year(), timestamp.Month(), timestamp.Day(), timestamp.Hour(), timestamp.Minute(), timestamp.Second(), timestamp.Nanosecond(), timestamp.Location())
+	if result.Sub(reference) > 24*time.Hour {
+		result = result.AddDate(-1, 0, 0)
+	}
+	return result
+}
+
 // EncodeTimestampUTC according to [AI] 29.5.4.4, always using timeframe type UTC
 func EncodeTimestampUTC(timestamp time.Time) []byte {
 	result := make([]byte, 3)
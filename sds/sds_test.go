@@ -5,7 +5,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ftl/tetra-pei/tetra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseMessage(t *testing.T) {
@@ -31,6 +33,31 @@ func TestParseMessage(t *testing.T) {
 				Payload: Status2,
 			},
 		},
+		{
+			desc:   "simple concatenated text message",
+			header: "+CTSDSR: 12,1234567,0,2345678,0,136",
+			pdu:    "0CC9020101746573746D65737361676531",
+			expected: IncomingMessage{
+				Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 136},
+				Payload: SimpleConcatenatedTextMessage{
+					protocol:         SimpleConcatenatedSDSMessaging,
+					MessageReference: 0xC9,
+					TotalNumber:      2,
+					SequenceNumber:   1,
+					Encoding:         ISO8859_1,
+					Text:             "testmessage1",
+				},
+			},
+		},
+		{
+			desc:   "8-bit status",
+			header: "+CTSDSR: 13,1234567,0,2345678,0,8",
+			pdu:    "2A",
+			expected: IncomingMessage{
+				Header:  Header{AIService: StatusService, Source: "1234567", Destination: "2345678", PDUBits: 8},
+				Payload: Status(0x002A),
+			},
+		},
 		{
 			desc:   "simple text message",
 			header: "+CTSDSR: 12,1234567,0,2345678,0,104",
@@ -143,8 +170,9 @@ func TestParseMessage(t *testing.T) {
 					MessageReference: 0x9C,
 					UserData: TextSDU{
 						TextHeader: TextHeader{
-							Encoding:  ISO8859_1,
-							Timestamp: expectedTimestamp,
+							Encoding:     ISO8859_1,
+							HasTimestamp: true,
+							Timestamp:    expectedTimestamp,
 						},
 						Text: "testmessage",
 					},
@@ -163,8 +191,9 @@ func TestParseMessage(t *testing.T) {
 					UserData: ConcatenatedTextSDU{
 						TextSDU: TextSDU{
 							TextHeader: TextHeader{
-								Encoding:  ISO8859_1,
-								Timestamp: expectedTimestamp,
+								Encoding:     ISO8859_1,
+								HasTimestamp: true,
+								Timestamp:    expectedTimestamp,
 							},
 							Text: "testmessage",
 						},
@@ -192,8 +221,9 @@ func TestParseMessage(t *testing.T) {
 					UserData: ConcatenatedTextSDU{
 						TextSDU: TextSDU{
 							TextHeader: TextHeader{
-								Encoding:  ISO8859_1,
-								Timestamp: expectedTimestamp,
+								Encoding:     ISO8859_1,
+								HasTimestamp: true,
+								Timestamp:    expectedTimestamp,
 							},
 							Text: "testmessage",
 						},
@@ -249,6 +279,24 @@ func TestParseMessage(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:   "SDS type 4, protocol identifier only",
+			header: "+CTSDSR: 12,1234567,0,2345678,0,8",
+			pdu:    "C3",
+			expected: IncomingMessage{
+				Header:  Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 8},
+				Payload: SDS4Message{protocol: 0xC3},
+			},
+		},
+		{
+			desc:   "SDS type 4 with data",
+			header: "+CTSDSR: 12,1234567,0,2345678,0,24",
+			pdu:    "C30102",
+			expected: IncomingMessage{
+				Header:  Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 24},
+				Payload: SDS4Message{protocol: 0xC3, Data: []byte{0x01, 0x02}},
+			},
+		},
 		{
 			desc:   "SDS-SHORT-REPORT success",
 			header: "+CTSDSR: 13,1234567,0,2345678,0,16",
@@ -284,6 +332,154 @@ func TestParseMessage(t *testing.T) {
 	}
 }
 
+func TestParseIncomingMessage_LenientHex(t *testing.T) {
+	expected, err := ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,120", "82029C01746573746D657373616765")
+	require.NoError(t, err)
+
+	tt := []struct {
+		desc string
+		pdu  string
+	}{
+		{desc: "lowercase", pdu: "82029c01746573746d657373616765"},
+		{desc: "mixed case", pdu: "82029C01746573746d657373616765"},
+		{desc: "embedded whitespace", pdu: " 82029C01 7465 7374\t6D65\r\n7373616765 "},
+		{desc: "trailing OK", pdu: "82029C01746573746D657373616765OK"},
+		{desc: "trailing ok with whitespace", pdu: "82029c01746573746d657373616765\r\nok\r\n"},
+		{desc: "trailing ERROR", pdu: "82029C01746573746D657373616765 ERROR"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,120", tc.pdu)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	_, err = ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,120", "82029C01746573746D6573736167OK65")
+	assert.Error(t, err)
+}
+
+func TestParseIncomingMessageLines(t *testing.T) {
+	expected, err := ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,120", "82029C01746573746D657373616765")
+	require.NoError(t, err)
+
+	actual, err := ParseIncomingMessageLines("+CTSDSR: 12,1234567,0,2345678,0,120", "82029C017465", "73746D657373", "616765")
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestParseLoggedMessage(t *testing.T) {
+	expected, err := ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,120", "82029C01746573746D657373616765")
+	require.NoError(t, err)
+
+	tt := []struct {
+		desc    string
+		line    string
+		invalid bool
+	}{
+		{
+			desc: "same line",
+			line: "+CTSDSR: 12,1234567,0,2345678,0,120 82029C01746573746D657373616765",
+		},
+		{
+			desc: "line break",
+			line: "+CTSDSR: 12,1234567,0,2345678,0,120\r\n82029C01746573746D657373616765\r\n",
+		},
+		{
+			desc: "escaped line break with timestamp",
+			line: `2026-10-15 10:15:00 RX +CTSDSR: 12,1234567,0,2345678,0,120\r\n82029C01746573746D657373616765`,
+		},
+		{
+			desc: "pipe delimiter",
+			line: "+CTSDSR: 12,1234567,0,2345678,0,120 | 82029C01746573746D657373616765",
+		},
+		{
+			desc: "spaces in header",
+			line: "+CTSDSR: 12, 1234567, 0, 2345678, 0, 120;82029c01746573746d657373616765",
+		},
+		{
+			desc: "trailing OK",
+			line: "+CTSDSR: 12,1234567,0,2345678,0,120\r\n82029c01746573746d657373616765\r\nOK\r\n",
+		},
+		{
+			desc:    "no header",
+			line:    "+CTGS: 1,1234567",
+			invalid: true,
+		},
+		{
+			desc:    "no PDU",
+			line:    "+CTSDSR: 12,1234567,0,2345678,0,120",
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseLoggedMessage(tc.line)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseSDSReport(t *testing.T) {
+	tt := []struct {
+		desc     string
+		pdu      []byte
+		expected SDSReport
+		invalid  bool
+	}{
+		{
+			desc: "received",
+			pdu:  []byte{0x82, 0x10, 0x00, 0xC9},
+			expected: SDSReport{
+				protocol:         TextMessaging,
+				DeliveryStatus:   ReceiptAckByDestination,
+				MessageReference: 0xC9,
+			},
+		},
+		{
+			desc: "consumed",
+			pdu:  []byte{0x82, 0x10, 0x02, 0xC9},
+			expected: SDSReport{
+				protocol:         TextMessaging,
+				DeliveryStatus:   ConsumedByDestination,
+				MessageReference: 0xC9,
+			},
+		},
+		{
+			desc:    "missing message reference",
+			pdu:     []byte{0x82, 0x10, 0x00},
+			invalid: true,
+		},
+		{
+			desc:    "wrong message type",
+			pdu:     []byte{0x82, 0x00, 0x00, 0xC9},
+			invalid: true,
+		},
+		{
+			desc:    "store/forward control flagged but missing",
+			pdu:     []byte{0x82, 0x11, 0x00, 0xC9},
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseSDSReport(tc.pdu)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
 func TestTimestampRoundtrip(t *testing.T) {
 	now := time.Now()
 	expected := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, time.Local).UTC()
@@ -378,10 +574,77 @@ func TestValidityPeriod_Encode(t *testing.T) {
 	}
 }
 
+func TestValidityPeriod_Roundtrip(t *testing.T) {
+	for code := byte(0); code < 32; code++ {
+		t.Run(fmt.Sprintf("%d", code), func(t *testing.T) {
+			period := ParseValidityPeriod(code)
+			encoded, bits := period.Encode()
+
+			assert.Equal(t, 8, bits)
+			assert.Equal(t, []byte{code}, encoded)
+			assert.Equal(t, period, ParseValidityPeriod(encoded[0]))
+		})
+	}
+}
+
 func TestStatusBytes(t *testing.T) {
 	assert.Equal(t, []byte{0x80, 0x04}, Status2.Bytes())
 }
 
+func TestEmergencyStatus(t *testing.T) {
+	status := NewEmergencyStatus()
+
+	bytes, bits := status.Encode([]byte{}, 0)
+
+	assert.True(t, status.IsEmergency())
+	assert.True(t, status.Sendable())
+	assert.False(t, status.IsUserDefined())
+	assert.Equal(t, []byte{0x00, 0x00}, bytes)
+	assert.Equal(t, 16, bits)
+}
+
+func TestStatusDirection(t *testing.T) {
+	tt := []struct {
+		value      Status
+		isRequest  bool
+		isResponse bool
+		expected   StatusDirection
+	}{
+		{0x8001, false, false, UnknownStatusDirection},
+		{Status0, true, false, StatusRequest},
+		{Status9, true, false, StatusRequest},
+		{0x800C, false, false, UnknownStatusDirection},
+		{0x80F1, false, false, UnknownStatusDirection},
+		{StatusA, false, true, StatusResponse},
+		{Statusu, false, true, StatusResponse},
+		{0x8100, false, false, UnknownStatusDirection},
+	}
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("%x", uint16(tc.value)), func(t *testing.T) {
+			assert.Equal(t, tc.isRequest, tc.value.IsRequest())
+			assert.Equal(t, tc.isResponse, tc.value.IsResponse())
+			assert.Equal(t, tc.expected, tc.value.Direction())
+			assert.Equal(t, tc.expected, StatusMessage{Value: tc.value}.Direction())
+		})
+	}
+}
+
+func TestParseIncomingMessage_UnsupportedService(t *testing.T) {
+	_, err := ParseIncomingMessage("+CTSDSR: 9,1234567,0,2345678,0,16", "1234")
+	assert.Error(t, err)
+
+	actual, err := ParseIncomingMessageWithOptions("+CTSDSR: 9,1234567,0,2345678,0,16", "1234", WithUnsupportedServices(SDS1Service))
+
+	require.NoError(t, err)
+	assert.Equal(t, UnsupportedServiceMessage{Service: SDS1Service, Raw: []byte{0x12, 0x34}}, actual.Payload)
+
+	_, err = ParseIncomingMessageWithOptions("+CTSDSR: 10,1234567,0,2345678,0,16", "1234", WithUnsupportedServices(SDS1Service))
+	assert.Error(t, err)
+
+	_, err = ParseIncomingMessage("+CTSDSR: 11,1234567,0,2345678,0,8", "C3")
+	assert.Error(t, err, "SDS type 3 is not parsed as SDS type 4")
+}
+
 func TestParseHeader(t *testing.T) {
 	tt := []struct {
 		desc     string
@@ -432,6 +695,60 @@ func TestParseHeader(t *testing.T) {
 				PDUBits:     16,
 			},
 		},
+		{
+			desc:  "valid with calling party subaddress",
+			value: "+CTSDSR: 12,1234567,0,2345678,0,1,42,16",
+			expected: Header{
+				AIService:              SDSTLService,
+				Source:                 "1234567",
+				Destination:            "2345678",
+				PDUBits:                16,
+				CallingPartySubaddress: "42",
+			},
+		},
+		{
+			desc:  "valid with identity types",
+			value: "+CTSDSR: 12,1234567,1,2345678,5,16",
+			expected: Header{
+				AIService:       SDSTLService,
+				Source:          "1234567",
+				SourceType:      tetra.TSI,
+				Destination:     "2345678",
+				DestinationType: tetra.ExtendedTSI,
+				PDUBits:         16,
+			},
+		},
+		{
+			desc:  "valid minimum set with destination identity type",
+			value: "+CTSDSR: 12,1234567,1,16",
+			expected: Header{
+				AIService:       SDSTLService,
+				Destination:     "1234567",
+				DestinationType: tetra.TSI,
+				PDUBits:         16,
+			},
+		},
+		{
+			desc:    "unknown source identity type",
+			value:   "+CTSDSR: 12,1234567,9,2345678,0,16",
+			invalid: true,
+		},
+		{
+			desc:    "unknown destination identity type",
+			value:   "+CTSDSR: 12,1234567,0,2345678,x,16",
+			invalid: true,
+		},
+		{
+			desc:  "valid with calling party subaddress and additional field",
+			value: "+CTSDSR: 12,1234567,0,2345678,0,1,42,0,16",
+			expected: Header{
+				AIService:              SDSTLService,
+				Source:                 "1234567",
+				Destination:            "2345678",
+				PDUBits:                16,
+				CallingPartySubaddress: "42",
+			},
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -446,6 +763,41 @@ func TestParseHeader(t *testing.T) {
 	}
 }
 
+func TestParseHeader_FormatError(t *testing.T) {
+	tt := []struct {
+		desc   string
+		value  string
+		fields int
+	}{
+		{
+			desc:   "5 fields",
+			value:  "+CTSDSR: 12,1234567,0,2345678,16",
+			fields: 5,
+		},
+		{
+			desc:   "2 fields",
+			value:  "+CTSDSR: 12,16",
+			fields: 2,
+		},
+		{
+			desc:   "10 fields",
+			value:  "+CTSDSR: 12,1234567,0,2345678,0,1,42,0,0,16",
+			fields: 10,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseHeader(tc.value)
+
+			var formatErr *HeaderFormatError
+			require.ErrorAs(t, err, &formatErr)
+			assert.Equal(t, tc.fields, formatErr.Fields)
+			assert.Equal(t, tc.value, formatErr.Raw)
+			assert.Contains(t, err.Error(), fmt.Sprintf("%d", tc.fields))
+		})
+	}
+}
+
 func TestEncode(t *testing.T) {
 	expectedTimestamp := time.Date(time.Now().Year(), time.April, 11, 8, 15, 0, 0, time.UTC)
 	tt := []struct {
@@ -485,8 +837,9 @@ func TestEncode(t *testing.T) {
 					MessageReference:      0xC9,
 					UserData: TextSDU{
 						TextHeader: TextHeader{
-							Encoding:  ISO8859_1,
-							Timestamp: expectedTimestamp,
+							Encoding:     ISO8859_1,
+							HasTimestamp: true,
+							Timestamp:    expectedTimestamp,
 						},
 						Text: "testmessage",
 					},
@@ -495,6 +848,14 @@ func TestEncode(t *testing.T) {
 			expectedBytes: []byte{0x82, 0x06, 0xC9, 0x81, 0x44, 0x5A, 0x0F, 0x74, 0x65, 0x73, 0x74, 0x6D, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65},
 			expectedBits:  144,
 		},
+		{
+			desc: "SDS type 4",
+			values: []Encoder{
+				NewSDS4Message(0xC3, []byte{0x01}),
+			},
+			expectedBytes: []byte{0xC3, 0x01},
+			expectedBits:  16,
+		},
 		{
 			desc: "simple text message",
 			values: []Encoder{
@@ -516,8 +877,9 @@ func TestEncode(t *testing.T) {
 					UserData: ConcatenatedTextSDU{
 						TextSDU: TextSDU{
 							TextHeader: TextHeader{
-								Encoding:  ISO8859_1,
-								Timestamp: expectedTimestamp,
+								Encoding:     ISO8859_1,
+								HasTimestamp: true,
+								Timestamp:    expectedTimestamp,
 							},
 							Text: "testmessage",
 						},
@@ -548,3 +910,717 @@ func TestEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestSDSTransfer_DeliveryReportAndServiceSelectionRoundtrip(t *testing.T) {
+	deliveryReportRequests := []DeliveryReportRequest{
+		NoReportRequested,
+		MessageReceivedReportRequested,
+		MessageConsumedReportRequested,
+		MessageReceivedAndConsumedReportRequested,
+	}
+	for _, deliveryReportRequest := range deliveryReportRequests {
+		for _, shortFormReport := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%d-%t", deliveryReportRequest, shortFormReport), func(t *testing.T) {
+				expected := SDSTransfer{
+					protocol:                        TextMessaging,
+					DeliveryReportRequest:           deliveryReportRequest,
+					ServiceSelectionShortFormReport: shortFormReport,
+					MessageReference:                0xC9,
+					UserData: TextSDU{
+						TextHeader: TextHeader{
+							Encoding: ISO8859_1,
+						},
+						Text: "testmessage",
+					},
+				}
+
+				bytes, _ := expected.Encode([]byte{}, 0)
+				actual, err := ParseSDSTransfer(bytes)
+
+				assert.NoError(t, err)
+				assert.Equal(t, expected, actual)
+				assert.Equal(t, byte(deliveryReportRequest)<<2, bytes[1]&0x0C)
+				assert.Equal(t, !shortFormReport, (bytes[1]&0x02) != 0)
+			})
+		}
+	}
+}
+
+func TestTimestampRelativeTo(t *testing.T) {
+	tt := []struct {
+		desc      string
+		timestamp time.Time
+		reference time.Time
+		expected  time.Time
+	}{
+		{
+			desc:      "same year",
+			timestamp: time.Date(2030, time.April, 11, 10, 15, 0, 0, time.UTC),
+			reference: time.Date(2021, time.April, 12, 0, 0, 0, 0, time.UTC),
+			expected:  time.Date(2021, time.April, 11, 10, 15, 0, 0, time.UTC),
+		},
+		{
+			desc:      "previous year",
+			timestamp: time.Date(2030, time.December, 31, 23, 0, 0, 0, time.UTC),
+			reference: time.Date(2022, time.January, 2, 10, 0, 0, 0, time.UTC),
+			expected:  time.Date(2021, time.December, 31, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:      "slightly ahead of reference",
+			timestamp: time.Date(2030, time.April, 11, 10, 15, 0, 0, time.UTC),
+			reference: time.Date(2021, time.April, 11, 10, 0, 0, 0, time.UTC),
+			expected:  time.Date(2021, time.April, 11, 10, 15, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual := TimestampRelativeTo(tc.timestamp, tc.reference)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestParseIncomingMessage_Packed7BitNotByteAligned(t *testing.T) {
+	// "testing" = 7 septets = 49 bits, the last byte contains 7 padding bits
+	actual, err := ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,81", "8200C900E9979F4D3BB380")
+	require.NoError(t, err)
+
+	transfer, ok := actual.Payload.(SDSTransfer)
+	require.True(t, ok)
+	sdu, ok := transfer.UserData.(TextSDU)
+	require.True(t, ok)
+	assert.Equal(t, Packed7Bit, sdu.Encoding)
+	assert.Equal(t, "testing", sdu.Text)
+}
+
+func TestParseIncomingMessageWithOptions_LazyText(t *testing.T) {
+	tt := []struct {
+		desc     string
+		header   string
+		pdu      string
+		options  []ParseOption
+		expected string
+	}{
+		{desc: "packed 7-bit not byte aligned", header: "+CTSDSR: 12,1234567,0,2345678,0,81", pdu: "8200C900E9979F4D3BB380", expected: "testing"},
+		{desc: "default fallback", header: "+CTSDSR: 12,1234567,0,2345678,0,72", pdu: fmt.Sprintf("8200C9%02X74657374E4", byte(VISCII)), expected: "testä"},
+		{desc: "CP437 fallback", header: "+CTSDSR: 12,1234567,0,2345678,0,72", pdu: fmt.Sprintf("8200C9%02X74657374E4", byte(VISCII)), options: []ParseOption{WithFallback(CodePage437)}, expected: "testΣ"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			eager, err := ParseIncomingMessageWithOptions(tc.header, tc.pdu, tc.options...)
+			require.NoError(t, err)
+			lazy, err := ParseIncomingMessageWithOptions(tc.header, tc.pdu, append(tc.options, WithLazyText())...)
+			require.NoError(t, err)
+
+			lazySDU, ok := lazy.Payload.(SDSTransfer).UserData.(LazyTextSDU)
+			require.True(t, ok)
+			text, err := lazySDU.DecodeText()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, text)
+
+			decoded, err := lazySDU.TextSDU()
+			assert.NoError(t, err)
+			assert.Equal(t, eager.Payload.(SDSTransfer).UserData, decoded)
+		})
+	}
+}
+
+func TestParseIncomingMessageWithOptions_CharacterCount(t *testing.T) {
+	header := "+CTSDSR: 12,1234567,0,2345678,0,88"
+	pdu := "8200C9010474657374"
+	expected := TextSDU{
+		TextHeader: TextHeader{Encoding: ISO8859_1, HasCharacterCount: true, CharacterCount: 4},
+		Text:       "test",
+	}
+
+	actual, err := ParseIncomingMessageWithOptions(header, pdu, WithCharacterCount())
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual.Payload.(SDSTransfer).UserData)
+
+	lazy, err := ParseIncomingMessageWithOptions(header, pdu, WithCharacterCount(), WithLazyText())
+	require.NoError(t, err)
+	decoded, err := lazy.Payload.(SDSTransfer).UserData.(LazyTextSDU).TextSDU()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decoded)
+
+	pduBytes, err := tetra.HexToBinary(pdu)
+	require.NoError(t, err)
+	transfer, err := ParseSDSTransferWithOptions(pduBytes, WithCharacterCount())
+	require.NoError(t, err)
+	assert.Equal(t, expected, transfer.UserData)
+
+	withoutOption, err := ParseIncomingMessage(header, pdu)
+	require.NoError(t, err)
+	assert.Equal(t, "\x04test", withoutOption.Payload.(SDSTransfer).UserData.(TextSDU).Text)
+}
+
+func TestNewTextMessageTransfer_Packed7BitRoundTrip(t *testing.T) {
+	transfer := NewTextMessageTransfer(0xC9, false, NoReportRequested, Packed7Bit, "hello")
+
+	encoded, bits := transfer.Encode(nil, 0)
+	actual, err := ParseIncomingMessage(fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d", bits), tetra.BinaryToHex(encoded))
+
+	require.NoError(t, err)
+	assert.Equal(t, transfer, actual.Payload)
+}
+
+func TestNewSimpleTextMessage(t *testing.T) {
+	tt := []struct {
+		desc      string
+		immediate bool
+		protocol  ProtocolIdentifier
+	}{
+		{desc: "simple", immediate: false, protocol: SimpleTextMessaging},
+		{desc: "immediate", immediate: true, protocol: SimpleImmediateTextMessaging},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			message := NewSimpleTextMessage(tc.immediate, ISO8859_1, "testmessage")
+
+			encoded, _ := message.Encode(nil, 0)
+			assert.Equal(t, byte(tc.protocol), encoded[0])
+
+			parsed, err := ParseSimpleTextMessage(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, tc.immediate, parsed.Immediate())
+			assert.Equal(t, message, parsed)
+		})
+	}
+}
+
+func TestProtocolIdentifier_Immediate(t *testing.T) {
+	tt := []struct {
+		value    ProtocolIdentifier
+		expected bool
+	}{
+		{SimpleTextMessaging, false},
+		{SimpleImmediateTextMessaging, true},
+		{SimpleConcatenatedSDSMessaging, false},
+		{TextMessaging, false},
+		{ImmediateTextMessaging, true},
+		{UserDataHeaderMessaging, false},
+		{ConcatenatedSDSMessaging, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.value.String(), func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.value.Immediate())
+			assert.Equal(t, tc.expected, SDSTransfer{protocol: tc.value}.Immediate())
+			assert.Equal(t, tc.expected, SimpleTextMessage{protocol: tc.value}.Immediate())
+		})
+	}
+}
+
+func TestProtocolIdentifier_String(t *testing.T) {
+	tt := []struct {
+		value    ProtocolIdentifier
+		expected string
+	}{
+		{SimpleTextMessaging, "SimpleTextMessaging"},
+		{SimpleImmediateTextMessaging, "SimpleImmediateTextMessaging"},
+		{SimpleConcatenatedSDSMessaging, "SimpleConcatenatedSDSMessaging"},
+		{TextMessaging, "TextMessaging"},
+		{ImmediateTextMessaging, "ImmediateTextMessaging"},
+		{UserDataHeaderMessaging, "UserDataHeaderMessaging"},
+		{ConcatenatedSDSMessaging, "ConcatenatedSDSMessaging"},
+		{ProtocolIdentifier(0xC3), "0xc3"},
+		{ProtocolIdentifier(0x01), "0x01"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.value.String())
+			if p, ok := ProtocolIdentifierByName[tc.expected]; ok {
+				assert.Equal(t, tc.value, p)
+			}
+		})
+	}
+	assert.Len(t, ProtocolIdentifierByName, 7)
+}
+
+func TestStoreForwardControl_TSIWithExtension(t *testing.T) {
+	bytes := []byte{0x52, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	expected := StoreForwardControl{
+		Valid:                   true,
+		ValidityPeriod:          ValidityPeriod(5 * time.Minute),
+		ForwardAddressType:      ForwardToTSI,
+		ForwardAddressSSI:       ForwardAddressSSI{0x01, 0x02, 0x03},
+		ForwardAddressExtension: ForwardAddressExtension{0x04, 0x05, 0x06},
+	}
+
+	actual, err := ParseStoreForwardControl(bytes)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, len(bytes), actual.Length())
+
+	encoded, bits := actual.Encode(nil, 0)
+	assert.Equal(t, bytes, encoded)
+	assert.Equal(t, len(bytes)*8, bits)
+
+	transfer := SDSTransfer{
+		protocol:            TextMessaging,
+		MessageReference:    0x9C,
+		StoreForwardControl: expected,
+		UserData: TextSDU{
+			TextHeader: TextHeader{Encoding: ISO8859_1},
+			Text:       "test",
+		},
+	}
+	encoded, bits = transfer.Encode(nil, 0)
+	assert.Equal(t, transfer.Length()*8, bits)
+	parsed, err := ParseSDSTransfer(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, expected, parsed.StoreForwardControl)
+	assert.Equal(t, transfer.UserData, parsed.UserData)
+
+	_, err = ParseStoreForwardControl(bytes[:4])
+	assert.Error(t, err)
+}
+
+func TestNewStoreForwardTextTransfer(t *testing.T) {
+	transfer := NewStoreForwardTextTransfer(0xC9, NewForwardAddressSSI(1234567), ValidityPeriod(5*time.Minute), ISO8859_1, "test")
+
+	encoded, bits := transfer.Encode(nil, 0)
+	assert.Equal(t, []byte{0x82, 0x03, 0xC9, 0x51, 0x12, 0xD6, 0x87, 0x01, 0x74, 0x65, 0x73, 0x74}, encoded)
+	assert.Equal(t, len(encoded)*8, bits)
+
+	parsed, err := ParseSDSTransfer(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, transfer, parsed)
+}
+
+func TestNewStoreForwardExternalTransfer_RoundTrip(t *testing.T) {
+	transfer, err := NewStoreForwardExternalTransfer(0xC9, "+493012345678", ValidityPeriod(5*time.Minute), ISO8859_1, "test")
+	require.NoError(t, err)
+
+	encoded, bits := transfer.Encode(nil, 0)
+	assert.Equal(t, []byte{0x82, 0x03, 0xC9, 0x53, 0x0D, 0xC4, 0x93, 0x01, 0x23, 0x45, 0x67, 0x80, 0x01, 0x74, 0x65, 0x73, 0x74}, encoded)
+	assert.Equal(t, len(encoded)*8, bits)
+	assert.Equal(t, len(encoded), transfer.Length())
+
+	incoming, err := ParseIncomingMessage(fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d", bits), tetra.BinaryToHex(encoded))
+	require.NoError(t, err)
+	assert.Equal(t, transfer, incoming.Payload)
+
+	var received Message
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		received = m
+	})
+	require.NoError(t, stack.Put(incoming))
+
+	number, ok := received.ExternalSubscriberNumber()
+	assert.True(t, ok)
+	assert.Equal(t, "+493012345678", number.String())
+	assert.Equal(t, "test", received.Text())
+}
+
+func TestParseExternalSubscriberNumber(t *testing.T) {
+	tt := []struct {
+		value    string
+		expected ExternalSubscriberNumber
+		invalid  bool
+	}{
+		{value: "0301234", expected: ExternalSubscriberNumber{0, 3, 0, 1, 2, 3, 4}},
+		{value: "*#+9", expected: ExternalSubscriberNumber{10, 11, 12, 9}},
+		{value: "", invalid: true},
+		{value: "030-1234", invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			actual, err := ParseExternalSubscriberNumber(tc.value)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.value, actual.String())
+		})
+	}
+}
+
+func TestParseSDSTransfer_WithoutSDU(t *testing.T) {
+	tt := []struct {
+		desc     string
+		bytes    []byte
+		expected SDSTransfer
+		invalid  bool
+	}{
+		{
+			desc:  "text messaging",
+			bytes: []byte{0x82, 0x06, 0xC9},
+			expected: SDSTransfer{
+				protocol:              TextMessaging,
+				DeliveryReportRequest: MessageReceivedReportRequested,
+				MessageReference:      0xC9,
+			},
+		},
+		{
+			desc:  "with store/forward control",
+			bytes: []byte{0x8A, 0x03, 0xC9, 0x57},
+			expected: SDSTransfer{
+				protocol:         UserDataHeaderMessaging,
+				MessageReference: 0xC9,
+				StoreForwardControl: StoreForwardControl{
+					Valid:              true,
+					ValidityPeriod:     ValidityPeriod(5 * time.Minute),
+					ForwardAddressType: NoForwardAddressPresent,
+				},
+			},
+		},
+		{
+			desc:    "too short",
+			bytes:   []byte{0x82, 0x00},
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseSDSTransfer(tc.bytes)
+			if tc.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+				assert.Nil(t, actual.UserData)
+			}
+		})
+	}
+}
+
+func TestSDSTransfer_EncodedBits(t *testing.T) {
+	timestamp := time.Date(2026, time.April, 11, 10, 15, 0, 0, time.UTC)
+	tt := []struct {
+		desc     string
+		transfer SDSTransfer
+	}{
+		{
+			desc:     "text message",
+			transfer: NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "testmessage"),
+		},
+		{
+			desc:     "immediate text message with timestamp",
+			transfer: NewTextMessageTransfer(0xC9, true, MessageReceivedReportRequested, ISO8859_1, "testmessage").WithTimestamp(timestamp),
+		},
+		{
+			desc:     "UTF-16",
+			transfer: NewTextMessageTransfer(0xC9, false, NoReportRequested, UTF16BE, "tëstmessäge"),
+		},
+		{
+			desc:     "packed 7-bit",
+			transfer: NewTextMessageTransfer(0xC9, false, NoReportRequested, Packed7Bit, "testing"),
+		},
+		{
+			desc:     "concatenated part",
+			transfer: NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, 128, "testmessage1testmessage2")[0],
+		},
+		{
+			desc: "store/forward control",
+			transfer: SDSTransfer{
+				protocol:            TextMessaging,
+				MessageReference:    0xC9,
+				StoreForwardControl: StoreForwardControl{Valid: true, ForwardAddressType: ForwardToSSI},
+				UserData:            TextSDU{TextHeader: NewTextHeader(ISO8859_1), Text: "test"},
+			},
+		},
+		{
+			desc:     "without SDU",
+			transfer: SDSTransfer{protocol: TextMessaging, MessageReference: 0xC9},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, bits := tc.transfer.Encode(nil, 0)
+			assert.Equal(t, bits, tc.transfer.EncodedBits())
+		})
+	}
+}
+
+func TestDeliveryStatus_Retryable(t *testing.T) {
+	tt := []struct {
+		value    DeliveryStatus
+		expected bool
+	}{
+		{ReceiptAckByDestination, false},
+		{ConsumedByDestination, false},
+		{Congestion, true},
+		{MessageStored, true},
+		{DestinationNotReachableMessageStored, true},
+		{NetworkOverload, true},
+		{ServiceTemporaryNotAvailable, true},
+		{DestinationMemoryFullMessageDiscarded, true},
+		{DestinationMemoryFull, true},
+		{ServicePermanentlyNotAvailable, false},
+		{DestinationNotAuthorzied, false},
+		{ProtocolNotSupported, false},
+		{DataCodingSchemeNotSupported, false},
+		{MessageTooLong, false},
+		{StopSending, false},
+	}
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("0x%02x", byte(tc.value)), func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.value.Retryable())
+		})
+	}
+}
+
+func TestSDSTransfer_WithTimestamp(t *testing.T) {
+	timestamp := time.Date(2026, time.April, 11, 10, 15, 0, 0, time.UTC)
+
+	withoutTimestamp, _ := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "test").Encode(nil, 0)
+	assert.Equal(t, byte(0x00), withoutTimestamp[3]&0x80)
+
+	encoded, bits := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "test").WithTimestamp(timestamp).Encode(nil, 0)
+	assert.Equal(t, byte(0x80), encoded[3]&0x80)
+	assert.Equal(t, EncodeTimestampUTC(timestamp), encoded[4:7])
+	assert.Equal(t, (len(withoutTimestamp)+3)*8, bits)
+
+	current := NewTextMessageTransfer(0xC9, false, NoReportRequested, ISO8859_1, "test").WithCurrentTimestamp()
+	assert.True(t, current.UserData.(TextSDU).TimestampUsed())
+}
+
+func TestSDSTransfer_WithTimestamp_ConcatenatedPartsUnchanged(t *testing.T) {
+	maxPDUBits := 128
+	transfers := NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, maxPDUBits, "testmessage1testmessage2")
+	require.Greater(t, len(transfers), 1)
+
+	for _, transfer := range transfers {
+		actual := transfer.WithTimestamp(time.Date(2021, time.April, 11, 10, 15, 0, 0, time.UTC))
+		assert.Equal(t, transfer, actual)
+		_, bits := actual.Encode(nil, 0)
+		assert.LessOrEqual(t, bits, maxPDUBits)
+	}
+}
+
+func TestNewConcatenatedMessageTransfer_WrappingReferences(t *testing.T) {
+	transfers := NewConcatenatedMessageTransfer(0xFE, NoReportRequested, ISO8859_1, 128, "first second third")
+	require.Len(t, transfers, 3)
+
+	references := make([]MessageReference, len(transfers))
+	for i, transfer := range transfers {
+		references[i] = transfer.MessageReference
+		assert.Equal(t, uint16(0xFE), transfer.UserData.(ConcatenatedTextSDU).UserDataHeader.MessageReference)
+	}
+	assert.Equal(t, []MessageReference{0xFE, 0xFF, 0x00}, references)
+
+	next := MessageReference(0xFE).Offset(len(transfers))
+	assert.Equal(t, MessageReference(0x01), next)
+	assert.NotContains(t, references, next)
+}
+
+func TestNewConcatenatedMessageTransferWithTimestamp(t *testing.T) {
+	timestamp := time.Date(2026, time.April, 11, 10, 15, 0, 0, time.UTC)
+	maxPDUBits := 128
+
+	transfers := NewConcatenatedMessageTransferWithTimestamp(0xC9, NoReportRequested, ISO8859_1, timestamp, maxPDUBits, "testmessage1testmessage2")
+
+	require.Greater(t, len(transfers), 1)
+	for _, transfer := range transfers {
+		encoded, bits := transfer.Encode(nil, 0)
+		assert.LessOrEqual(t, bits, maxPDUBits)
+		assert.Equal(t, byte(0x80), encoded[3]&0x80)
+		assert.Equal(t, EncodeTimestampUTC(timestamp), encoded[4:7])
+	}
+
+	single := NewConcatenatedMessageTransferWithTimestamp(0xC9, NoReportRequested, ISO8859_1, timestamp, 256, "test")
+	require.Len(t, single, 1)
+	encoded, _ := single[0].Encode(nil, 0)
+	assert.Equal(t, byte(0x80), encoded[3]&0x80)
+}
+
+func TestParseSDSTransfer_StoreForwardControlOverrun(t *testing.T) {
+	tt := []struct {
+		desc  string
+		bytes []byte
+	}{
+		{
+			desc:  "SSI",
+			bytes: []byte{0x82, 0x07, 0xC9, 0x51, 0x01},
+		},
+		{
+			desc:  "TSI",
+			bytes: []byte{0x82, 0x07, 0xC9, 0x52, 0x01, 0x02, 0x03},
+		},
+		{
+			desc:  "external subscriber number",
+			bytes: []byte{0x82, 0x07, 0xC9, 0x53, 0x06, 0x12},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseSDSTransfer(tc.bytes)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStoreForwardControl_ExternalSubscriberNumber(t *testing.T) {
+	bytes := []byte{0x53, 0x03, 0x12, 0x30}
+
+	actual, err := ParseStoreForwardControl(bytes)
+	require.NoError(t, err)
+	assert.Equal(t, ExternalSubscriberNumber{1, 2, 3}, actual.ExternalSubscriberNumber)
+	assert.Equal(t, len(bytes), actual.Length())
+}
+
+func TestDecodeTimestampUTC(t *testing.T) {
+	year := time.Now().Year()
+	tt := []struct {
+		desc     string
+		bytes    []byte
+		expected time.Time
+	}{
+		{
+			desc:     "local",
+			bytes:    []byte{0x04, 0x5A, 0x8F},
+			expected: time.Date(year, time.April, 11, 10, 15, 0, 0, time.Local).UTC(),
+		},
+		{
+			desc:     "UTC",
+			bytes:    []byte{0x44, 0x5A, 0x8F},
+			expected: time.Date(year, time.April, 11, 10, 15, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := DecodeTimestampUTC(tc.bytes)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, time.UTC, actual.Location())
+		})
+	}
+
+	_, err := DecodeTimestampUTC([]byte{0x44})
+	assert.Error(t, err)
+}
+
+func TestParseReport(t *testing.T) {
+	tt := []struct {
+		desc              string
+		bytes             []byte
+		expected          Report
+		expectedReference MessageReference
+		expectedStatus    DeliveryStatus
+		expectedShort     bool
+		invalid           bool
+	}{
+		{
+			desc:              "short form",
+			bytes:             []byte{0x7E, 0xC9},
+			expected:          SDSShortReport{ReportType: MessageReceivedShort, MessageReference: 0xC9},
+			expectedReference: 0xC9,
+			expectedStatus:    ReceiptAckByDestination,
+			expectedShort:     true,
+		},
+		{
+			desc:              "long form",
+			bytes:             []byte{0x82, 0x10, 0x02, 0xC9},
+			expected:          SDSReport{protocol: TextMessaging, DeliveryStatus: ConsumedByDestination, MessageReference: 0xC9},
+			expectedReference: 0xC9,
+			expectedStatus:    ConsumedByDestination,
+		},
+		{
+			desc:    "no report",
+			bytes:   []byte{0x82, 0x04, 0xC9, 0x01},
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseReport(tc.bytes)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.expectedReference, actual.Reference())
+			assert.Equal(t, tc.expectedStatus, actual.Status())
+			assert.Equal(t, tc.expectedShort, actual.Short())
+
+			encoded, _ := actual.Encode(nil, 0)
+			reparsed, err := ParseReport(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, actual, reparsed)
+		})
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	shortForm := SDSTransfer{protocol: TextMessaging, MessageReference: 0xC9, ServiceSelectionShortFormReport: true}
+	fullForm := SDSTransfer{protocol: TextMessaging, MessageReference: 0xC9}
+	tt := []struct {
+		desc          string
+		transfer      SDSTransfer
+		status        DeliveryStatus
+		expected      Encoder
+		expectedShort bool
+	}{
+		{
+			desc:          "received, short form",
+			transfer:      shortForm,
+			status:        ReceiptAckByDestination,
+			expected:      SDSShortReport{ReportType: MessageReceivedShort, MessageReference: 0xC9},
+			expectedShort: true,
+		},
+		{
+			desc:          "consumed, short form",
+			transfer:      shortForm,
+			status:        ConsumedByDestination,
+			expected:      SDSShortReport{ReportType: MessageConsumedShort, MessageReference: 0xC9},
+			expectedShort: true,
+		},
+		{
+			desc:          "data coding scheme not supported, short form",
+			transfer:      shortForm,
+			status:        DataCodingSchemeNotSupported,
+			expected:      SDSShortReport{ReportType: ProtocolOrEncodingNotSupportedShort, MessageReference: 0xC9},
+			expectedShort: true,
+		},
+		{
+			desc:     "not expressible as short report",
+			transfer: shortForm,
+			status:   MessageTooLong,
+			expected: SDSReport{protocol: TextMessaging, DeliveryStatus: MessageTooLong, MessageReference: 0xC9},
+		},
+		{
+			desc:     "received, full form",
+			transfer: fullForm,
+			status:   ReceiptAckByDestination,
+			expected: SDSReport{protocol: TextMessaging, DeliveryStatus: ReceiptAckByDestination, MessageReference: 0xC9},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, short := BuildReport(tc.transfer, tc.status)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.expectedShort, short)
+		})
+	}
+}
+
+func TestNewSimpleConcatenatedTextMessages(t *testing.T) {
+	parts := NewSimpleConcatenatedTextMessages(0xC9, ISO8859_1, 136, "testmessage1testmessage2")
+	require.Len(t, parts, 2)
+
+	for i, part := range parts {
+		pdu, bits := part.Encode(nil, 0)
+		assert.LessOrEqual(t, bits, 136)
+		assert.Equal(t, part.Length()*8, bits)
+
+		parsed, err := ParseSimpleConcatenatedTextMessage(pdu)
+		require.NoErrorf(t, err, "part %d", i)
+		assert.Equal(t, part, parsed)
+	}
+}
+
+func TestSupportedProtocols(t *testing.T) {
+	expected := []ProtocolIdentifier{
+		SimpleTextMessaging,
+		SimpleImmediateTextMessaging,
+		SimpleConcatenatedSDSMessaging,
+		TextMessaging,
+		ImmediateTextMessaging,
+		UserDataHeaderMessaging,
+	}
+
+	assert.Equal(t, expected, SupportedProtocols())
+}
@@ -12,7 +12,21 @@ type Message struct {
 	Source      tetra.Identity
 	Destination tetra.Identity
 	Timestamp   time.Time
+	scheme      UDHInformationElementID
 	parts       []part
+	location    Location
+	hasLocation bool
+	immediate   bool
+
+	externalNumber ExternalSubscriberNumber
+}
+
+// MessageKey identifies a message uniquely among all messages that are currently received.
+type MessageKey struct {
+	Source      tetra.Identity
+	Destination tetra.Identity
+	Scheme      UDHInformationElementID
+	Reference   int
 }
 
 func NewMessage(id int, source tetra.Identity, destination tetra.Identity, timestamp time.Time, parts int) Message {
@@ -25,6 +39,16 @@ func NewMessage(id int, source tetra.Identity, destination tetra.Identity, times
 	}
 }
 
+// Key returns the key that identifies this message independent of other messages using the same reference.
+func (m Message) Key() MessageKey {
+	return MessageKey{
+		Source:      m.Source,
+		Destination: m.Destination,
+		Scheme:      m.scheme,
+		Reference:   m.ID,
+	}
+}
+
 func (m Message) Complete() bool {
 	for _, part := range m.parts {
 		if !part.Valid {
@@ -34,6 +58,12 @@ func (m Message) Complete() bool {
 	return true
 }
 
+// hasPart indicates if the given 1-based part of this message was already received.
+func (m Message) hasPart(i int) bool {
+	i -= 1
+	return i >= 0 && i < len(m.parts) && m.parts[i].Valid
+}
+
 func (m Message) Text() string {
 	var result string
 	for _, part := range m.parts {
@@ -52,18 +82,140 @@ func (m Message) String() string {
 }
 
 func (m *Message) SetPart(i int, text string) {
+	m.SetPartWithTimestamp(i, text, time.Time{})
+}
+
+// SetPartWithTimestamp sets the text of the given part together with the timestamp of this part.
+// The timestamp of the message is the earliest timestamp of all its parts.
+func (m *Message) SetPartWithTimestamp(i int, text string, timestamp time.Time) {
 	i -= 1
 	if i < 0 || i >= len(m.parts) {
 		return
 	}
 
 	m.parts[i].Text = text
+	m.parts[i].Timestamp = timestamp
 	m.parts[i].Valid = true
+
+	if !timestamp.IsZero() && (m.Timestamp.IsZero() || timestamp.Before(m.Timestamp)) {
+		m.Timestamp = timestamp
+	}
+}
+
+// Append adds a new part with the given text and timestamp to the end of this message.
+func (m *Message) Append(text string, timestamp time.Time) {
+	m.parts = append(m.parts, part{})
+	m.SetPartWithTimestamp(len(m.parts), text, timestamp)
+}
+
+// MessageKind classifies the content of a message.
+type MessageKind int
+
+// All message kinds
+const (
+	TextMessageKind MessageKind = iota
+	LocationMessageKind
+)
+
+// Kind returns the kind of content of this message. A message with an embedded location is a location message,
+// all other messages are text messages.
+func (m Message) Kind() MessageKind {
+	if m.hasLocation {
+		return LocationMessageKind
+	}
+	return TextMessageKind
+}
+
+// Immediate indicates if this message should be displayed/handled immediately.
+func (m Message) Immediate() bool {
+	return m.immediate
+}
+
+// Location returns the location that was embedded in the message, if there is one.
+func (m Message) Location() (Location, bool) {
+	return m.location, m.hasLocation
+}
+
+// SetLocation sets the location that was embedded in the message.
+func (m *Message) SetLocation(location Location) {
+	m.location = location
+	m.hasLocation = true
+}
+
+// ExternalSubscriberNumber returns the external subscriber number to which the message should be forwarded,
+// if the sender requested store and forward delivery to an external subscriber number.
+func (m Message) ExternalSubscriberNumber() (ExternalSubscriberNumber, bool) {
+	return m.externalNumber, len(m.externalNumber) > 0
+}
+
+// PartTimestamps returns the timestamps of all parts of this message. The timestamp of a part is zero if
+// the part is not yet received or has no timestamp.
+func (m Message) PartTimestamps() []time.Time {
+	result := make([]time.Time, len(m.parts))
+	for i, part := range m.parts {
+		result[i] = part.Timestamp
+	}
+	return result
+}
+
+// forwardEncodings are the preferred encodings to re-encode a message for forwarding.
+var forwardEncodings = []TextEncoding{ISO8859_1, UTF16BE}
+
+// ToTransfers re-encodes this message into SDS-TRANSFER PDUs, e.g. to forward it to another destination. The part boundaries
+// and the timestamps of the parts are preserved, parts that do not fit into the given maximum number of PDU bits are split further.
+// Parts that were not received are skipped. A message that results in only one part is encoded as simple text message transfer.
+func (m Message) ToTransfers(messageReference MessageReference, maxPDUBits int) []SDSTransfer {
+	sdus := make([]ConcatenatedTextSDU, 0, len(m.parts))
+	for _, part := range m.parts {
+		if !part.Valid {
+			continue
+		}
+		sdu := ConcatenatedTextSDU{
+			TextSDU: TextSDU{
+				TextHeader: NewTextHeader(ChooseEncoding(part.Text, forwardEncodings)),
+			},
+			UserDataHeader: ConcatenatedTextUDH{
+				ElementID:        ConcatenatedTextMessageWithShortReference,
+				MessageReference: uint16(messageReference),
+			},
+		}
+		if !part.Timestamp.IsZero() {
+			sdu.TextHeader = NewTextHeaderWithTimestamp(sdu.Encoding, part.Timestamp)
+		}
+		blueprintBits := SDSTransfer{protocol: UserDataHeaderMessaging, UserData: sdu}.Length() * 8
+
+		for _, text := range SplitToMaxBits(sdu.Encoding, maxPDUBits-blueprintBits, part.Text) {
+			sdu.Text = text
+			sdus = append(sdus, sdu)
+		}
+	}
+
+	if len(sdus) == 1 {
+		return []SDSTransfer{{
+			protocol:         TextMessaging,
+			MessageReference: messageReference,
+			UserData:         sdus[0].TextSDU,
+		}}
+	}
+
+	result := make([]SDSTransfer, len(sdus))
+	for i, sdu := range sdus {
+		sdu.UserDataHeader.TotalNumber = byte(len(sdus))
+		sdu.UserDataHeader.SequenceNumber = byte(i + 1)
+		result[i] = SDSTransfer{
+			protocol:                        UserDataHeaderMessaging,
+			ServiceSelectionShortFormReport: true,
+			MessageReference:                messageReference.Offset(i),
+			UserData:                        sdu,
+		}
+	}
+	return result
 }
 
 type part struct {
-	Valid bool
-	Text  string
+	Valid     bool
+	Text      string
+	Timestamp time.Time
 }
 
 type MessageCallback func(Message)
@@ -78,21 +230,365 @@ func (s StatusMessage) String() string {
 	return fmt.Sprintf("Status 0x%x from %s to %s", s.Value, s.Source, s.Destination)
 }
 
+// Direction indicates if this status message is a request or a response.
+func (s StatusMessage) Direction() StatusDirection {
+	return s.Value.Direction()
+}
+
 type StatusCallback func(StatusMessage)
 
+// ReportMessage contains the delivery status for a sent message, reported by a SDS-REPORT or a SDS-SHORT-REPORT.
+type ReportMessage struct {
+	Source           tetra.Identity
+	Destination      tetra.Identity
+	MessageReference MessageReference
+	DeliveryStatus   DeliveryStatus
+	Short            bool
+}
+
+func (r ReportMessage) String() string {
+	return fmt.Sprintf("Report 0x%x for message 0x%x from %s to %s", r.DeliveryStatus, r.MessageReference, r.Source, r.Destination)
+}
+
+type ReportCallback func(ReportMessage)
+
+// DataMessage contains the payload of an incoming message that carries no text, status, or report:
+// either an SDS4Message or an UnsupportedServiceMessage.
+type DataMessage struct {
+	Source      tetra.Identity
+	Destination tetra.Identity
+	Payload     interface{}
+}
+
+type DataCallback func(DataMessage)
+
 type ResponseCallback func([]string) error
 
+// Clock provides the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc wraps a function into the Clock interface.
+type ClockFunc func() time.Time
+
+// Now calls the wrapped ClockFunc.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// MessagePart is the state of a single part of a message.
+type MessagePart struct {
+	Valid     bool
+	Text      string
+	Timestamp time.Time
+}
+
+// MessageSnapshot contains the complete state of a message in exported fields, e.g. to serialize pending messages
+// in a PendingStore. Use Message.Snapshot and NewMessageFromSnapshot to convert between a message and its snapshot.
+type MessageSnapshot struct {
+	ID             int
+	Source         tetra.Identity
+	Destination    tetra.Identity
+	Timestamp      time.Time
+	Scheme         UDHInformationElementID
+	Parts          []MessagePart
+	Location       *Location
+	Immediate      bool
+	ExternalNumber ExternalSubscriberNumber
+}
+
+// Snapshot returns the complete state of this message.
+func (m Message) Snapshot() MessageSnapshot {
+	result := MessageSnapshot{
+		ID:             m.ID,
+		Source:         m.Source,
+		Destination:    m.Destination,
+		Timestamp:      m.Timestamp,
+		Scheme:         m.scheme,
+		Parts:          make([]MessagePart, len(m.parts)),
+		Immediate:      m.immediate,
+		ExternalNumber: m.externalNumber,
+	}
+	for i, part := range m.parts {
+		result.Parts[i] = MessagePart(part)
+	}
+	if m.hasLocation {
+		location := m.location
+		result.Location = &location
+	}
+	return result
+}
+
+// NewMessageFromSnapshot restores a message from the given snapshot.
+func NewMessageFromSnapshot(snapshot MessageSnapshot) Message {
+	result := Message{
+		ID:             snapshot.ID,
+		Source:         snapshot.Source,
+		Destination:    snapshot.Destination,
+		Timestamp:      snapshot.Timestamp,
+		scheme:         snapshot.Scheme,
+		parts:          make([]part, len(snapshot.Parts)),
+		immediate:      snapshot.Immediate,
+		externalNumber: snapshot.ExternalNumber,
+	}
+	for i, p := range snapshot.Parts {
+		result.parts[i] = part(p)
+	}
+	if snapshot.Location != nil {
+		result.SetLocation(*snapshot.Location)
+	}
+	return result
+}
+
+// PendingStore persists the messages that are not yet complete, e.g. to restore them after a restart.
+// Stores that need to serialize the messages can use Message.Snapshot and NewMessageFromSnapshot.
+type PendingStore interface {
+	// Save stores the given message, replacing any stored message with the same key.
+	Save(Message)
+	// Delete removes the message with the given key.
+	Delete(MessageKey)
+	// Load returns all stored messages.
+	Load() []Message
+}
+
+// InMemoryPendingStore is a PendingStore that keeps the messages in memory.
+type InMemoryPendingStore struct {
+	messages map[MessageKey]Message
+}
+
+func NewInMemoryPendingStore() *InMemoryPendingStore {
+	return &InMemoryPendingStore{
+		messages: make(map[MessageKey]Message),
+	}
+}
+
+func (s *InMemoryPendingStore) Save(message Message) {
+	s.messages[message.Key()] = message
+}
+
+func (s *InMemoryPendingStore) Delete(key MessageKey) {
+	delete(s.messages, key)
+}
+
+func (s *InMemoryPendingStore) Load() []Message {
+	result := make([]Message, 0, len(s.messages))
+	for _, message := range s.messages {
+		result = append(result, message)
+	}
+	return result
+}
+
 type Stack struct {
 	messageCallback  MessageCallback
 	statusCallback   StatusCallback
+	reportCallback   ReportCallback
+	dataCallback     DataCallback
 	responseCallback ResponseCallback
-	pendingMessages  map[int]Message
+	pendingMessages  map[MessageKey]Message
+	pendingStore     PendingStore
+	currentService   serviceSelection
+	sendConfig       SendConfig
+	withoutE2EE      bool
+	restoreService   bool
+	clock            Clock
+	referenceClock   bool
+	stampReceived    bool
+	reportOptions    reportOptions
+
+	restartOnTotalMismatch bool
+
+	conversationWindow time.Duration
+	conversationLimit  int
+	conversations      map[tetra.Identity]conversation
+
+	ackWindow    time.Duration
+	ackedReports map[ackedReport]time.Time
+
+	sentMessages map[sentMessageKey]SentMessage
+	sentParts    map[sentPartKey]sentPartIndex
+
+	metrics StackMetrics
+}
+
+// StackMetrics contains the counters of a stack.
+type StackMetrics struct {
+	// ReceivedParts counts the received parts of text messages, single-part messages included.
+	ReceivedParts int
+	// CompletedMessages counts the complete text messages that were delivered to the message callback.
+	CompletedMessages int
+	// DiscardedIncomplete counts the incomplete messages that were discarded because a part did not match.
+	// The stack does not expire incomplete messages by time.
+	DiscardedIncomplete int
+	// DuplicatePartsSuppressed counts the parts that were received again for an incomplete message and were ignored.
+	DuplicatePartsSuppressed int
+	// Errors counts the parts that could not be processed by the stack.
+	Errors int
+}
+
+// ackedReport identifies a SDS-REPORT that was acknowledged by the stack.
+type ackedReport struct {
+	source           tetra.Identity
+	messageReference MessageReference
+	deliveryStatus   DeliveryStatus
+}
+
+// DefaultAckWindow is the default time within which a retransmitted SDS-REPORT is not acknowledged again.
+const DefaultAckWindow = 30 * time.Second
+
+// conversation is the last single-part message that was received from one source.
+type conversation struct {
+	message  Message
+	received time.Time
+}
+
+type reportOptions struct {
+	ackRequired     bool
+	receivedStatus  DeliveryStatus
+	consumedStatus  DeliveryStatus
+	consumedEnabled bool
 }
 
 func NewStack() *Stack {
 	return &Stack{
-		pendingMessages: make(map[int]Message),
+		pendingMessages:   make(map[MessageKey]Message),
+		conversations:     make(map[tetra.Identity]conversation),
+		ackedReports:      make(map[ackedReport]time.Time),
+		sentMessages:      make(map[sentMessageKey]SentMessage),
+		sentParts:         make(map[sentPartKey]sentPartIndex),
+		ackWindow:         DefaultAckWindow,
+		conversationLimit: DefaultConversationLimit,
+		sendConfig:        DefaultSendConfig,
+		clock:             ClockFunc(time.Now),
+		reportOptions: reportOptions{
+			receivedStatus: ReceiptAckByDestination,
+		},
+	}
+}
+
+// WithReportOptions configures the SDS-REPORTs that the stack sends in response to incoming text messages.
+// The given received status is reported if the sender requested a report for receipt. If the sender
+// requested a report for consumation, the given consumed status is reported if a message callback is set
+// to consume the message. Consumation is only reported if the report options are set explicitly.
+func (s *Stack) WithReportOptions(ackRequired bool, receivedStatus DeliveryStatus, consumedStatus DeliveryStatus) *Stack {
+	s.reportOptions = reportOptions{
+		ackRequired:     ackRequired,
+		receivedStatus:  receivedStatus,
+		consumedStatus:  consumedStatus,
+		consumedEnabled: true,
+	}
+	return s
+}
+
+// WithPendingStore lets the stack persist its pending messages in the given store. The messages that are already
+// stored are restored as pending messages. Without a store, the pending messages are only kept in memory.
+func (s *Stack) WithPendingStore(store PendingStore) *Stack {
+	s.pendingStore = store
+	for _, message := range store.Load() {
+		s.pendingMessages[message.Key()] = message
+	}
+	return s
+}
+
+// WithRestartOnTotalMismatch defines how the stack handles a part of a concatenated message whose total number of parts
+// does not match the parts received before. If restart is true, the assembly restarts with the new total and the parts
+// received before are dropped. Otherwise, the pending message is discarded and Put returns an error.
+func (s *Stack) WithRestartOnTotalMismatch(restart bool) *Stack {
+	s.restartOnTotalMismatch = restart
+	return s
+}
+
+// WithConversationGrouping lets the stack group single-part text messages from the same source to the same destination
+// that are received within the given window after the previous one. The messages of a group are delivered as one
+// message to which each new text is appended as a new part. A window of zero disables the grouping.
+// A group holds at most the number of parts set with WithConversationLimit, the next message starts a new group.
+func (s *Stack) WithConversationGrouping(window time.Duration) *Stack {
+	s.conversationWindow = window
+	return s
+}
+
+// DefaultConversationLimit is the default maximum number of parts in a group of single-part text messages.
+const DefaultConversationLimit = 100
+
+// WithConversationLimit sets the maximum number of parts in a group of single-part text messages
+// (see WithConversationGrouping). A limit of zero or less disables the limit.
+func (s *Stack) WithConversationLimit(parts int) *Stack {
+	s.conversationLimit = parts
+	return s
+}
+
+// groupConversation appends the given single-part message to the current conversation with its source,
+// if conversation grouping is enabled and the message was received within the window.
+func (s *Stack) groupConversation(message Message) Message {
+	if s.conversationWindow <= 0 || len(message.parts) != 1 {
+		return message
+	}
+
+	now := s.clock.Now()
+	for source, conversation := range s.conversations {
+		if now.Sub(conversation.received) > s.conversationWindow {
+			delete(s.conversations, source)
+		}
+	}
+
+	current, ok := s.conversations[message.Source]
+	withinLimit := s.conversationLimit <= 0 || len(current.message.parts) < s.conversationLimit
+	if ok && current.message.Destination == message.Destination && withinLimit {
+		part := message.parts[0]
+		current.message.Append(part.Text, part.Timestamp)
+		message = current.message
+	}
+
+	s.conversations[message.Source] = conversation{
+		message:  message,
+		received: now,
+	}
+	return message
+}
+
+// WithAckWindow sets the time within which a retransmitted SDS-REPORT that requires an acknowledgement is not
+// acknowledged again. A window of zero disables the suppression of duplicate acknowledgements.
+func (s *Stack) WithAckWindow(window time.Duration) *Stack {
+	s.ackWindow = window
+	return s
+}
+
+// WithClock sets the clock that is used to measure the conversation and acknowledgement windows and to stamp
+// received messages (see WithReceivedTimestamps).
+func (s *Stack) WithClock(clock Clock) *Stack {
+	s.clock = clock
+	return s
+}
+
+// WithReferenceClock works like WithClock, but additionally uses the given clock as reference for the year of
+// received timestamps, which do not contain the year. Use this with the radio's clock (see ctrl.RequestClock)
+// if the host's clock cannot be trusted.
+func (s *Stack) WithReferenceClock(clock Clock) *Stack {
+	s.clock = clock
+	s.referenceClock = true
+	return s
+}
+
+// WithReceivedTimestamps defines if messages and parts without a timestamp are stamped with the time of reception,
+// taken from the stack's clock. By default, their timestamp is the zero time.
+func (s *Stack) WithReceivedTimestamps(stamp bool) *Stack {
+	s.stampReceived = stamp
+	return s
+}
+
+// receivedTimestamp returns the given timestamp relative to the reference clock, if the stack uses one. A zero timestamp
+// is replaced by the time of reception, if the stack stamps received messages.
+func (s *Stack) receivedTimestamp(timestamp time.Time) time.Time {
+	if timestamp.IsZero() {
+		if s.stampReceived {
+			return s.clock.Now()
+		}
+		return timestamp
+	}
+	if !s.referenceClock {
+		return timestamp
 	}
+	return TimestampRelativeTo(timestamp, s.clock.Now())
 }
 
 func (s *Stack) WithMessageCallback(callback MessageCallback) *Stack {
@@ -105,12 +601,130 @@ func (s *Stack) WithStatusCallback(callback StatusCallback) *Stack {
 	return s
 }
 
+func (s *Stack) WithReportCallback(callback ReportCallback) *Stack {
+	s.reportCallback = callback
+	return s
+}
+
+// WithDataCallback sets the callback for incoming messages that carry an SDS4Message or an UnsupportedServiceMessage.
+func (s *Stack) WithDataCallback(callback DataCallback) *Stack {
+	s.dataCallback = callback
+	return s
+}
+
 func (s *Stack) WithResponseCallback(callback ResponseCallback) *Stack {
 	s.responseCallback = callback
 	return s
 }
 
+// WithSendConfig sets the line endings that the stack uses for the reports and acknowledgements it sends.
+func (s *Stack) WithSendConfig(config SendConfig) *Stack {
+	s.sendConfig = config
+	return s
+}
+
+// WithE2EE defines if the stack selects the SDS-TL AI service with end-to-end encryption (the default) or without.
+func (s *Stack) WithE2EE(e2ee bool) *Stack {
+	s.withoutE2EE = !e2ee
+	return s
+}
+
+// WithServiceRestore defines if the stack selects the previously selected AI service again after it sent
+// reports or acknowledgements that required to switch the AI service. The previous service must be known
+// to the stack (see SetCurrentService).
+func (s *Stack) WithServiceRestore(restore bool) *Stack {
+	s.restoreService = restore
+	return s
+}
+
+// SetCurrentService lets the stack know which AI service is currently selected on the radio.
+// The stack uses this information to omit redundant AT+CTSDS commands. For the SDS-TL AI service, the stack
+// assumes that the variant is selected that it would select itself (see WithE2EE).
+func (s *Stack) SetCurrentService(service AIService) {
+	s.currentService = s.selectionOf(service)
+}
+
+// serviceSelection identifies the AI service that is selected on the radio, including the SDS-TL variant.
+type serviceSelection struct {
+	service     AIService
+	withoutE2EE bool
+}
+
+// selectionOf returns the selection that the stack uses for the given AI service.
+func (s *Stack) selectionOf(service AIService) serviceSelection {
+	return serviceSelection{
+		service:     service,
+		withoutE2EE: service == SDSTLService && s.withoutE2EE,
+	}
+}
+
+// switchToService returns the given commands with the command to select the given AI service in front,
+// if the given service is not already selected according to the given selection. The selection is updated
+// accordingly, the stack's current service is only updated by respond.
+func (s *Stack) switchToService(selection *serviceSelection, service AIService, commands ...string) []string {
+	target := s.selectionOf(service)
+	if *selection == target {
+		return commands
+	}
+	switchCommand, ok := switchCommands[service]
+	if !ok {
+		return commands
+	}
+	if target.withoutE2EE {
+		switchCommand = SwitchToSDSTLWithE2EE(false)
+	}
+	*selection = target
+	return append([]string{switchCommand}, commands...)
+}
+
+// restorePreviousService returns the given commands with the command to select the given previous selection appended,
+// if the service restore is enabled and the previous selection is not the given selection anymore.
+func (s *Stack) restorePreviousService(selection *serviceSelection, previous serviceSelection, commands []string) []string {
+	if !s.restoreService || previous.service == "" || *selection == previous {
+		return commands
+	}
+	switchCommand, ok := switchCommands[previous.service]
+	if !ok {
+		return commands
+	}
+	if previous.service == SDSTLService {
+		switchCommand = SwitchToSDSTLWithE2EE(!previous.withoutE2EE)
+	}
+	*selection = previous
+	return append(commands, switchCommand)
+}
+
+// respond sends the given commands using the response callback. The given selection becomes the stack's current
+// service only if the commands were sent successfully. Otherwise, the current service is unknown and the stack
+// selects the AI service again with the next response.
+func (s *Stack) respond(selection serviceSelection, commands []string) {
+	err := s.responseCallback(commands)
+	if err != nil {
+		s.currentService = serviceSelection{}
+		return
+	}
+	s.currentService = selection
+}
+
+var switchCommands = map[AIService]string{
+	SDSTLService:  SwitchToSDSTL,
+	StatusService: SwitchToStatus,
+}
+
+// Metrics returns the current counters of this stack.
+func (s *Stack) Metrics() StackMetrics {
+	return s.metrics
+}
+
 func (s *Stack) Put(part IncomingMessage) error {
+	err := s.put(part)
+	if err != nil {
+		s.metrics.Errors++
+	}
+	return err
+}
+
+func (s *Stack) put(part IncomingMessage) error {
 	switch payload := part.Payload.(type) {
 	case Status:
 		// log.Print("incoming status")
@@ -124,6 +738,7 @@ func (s *Stack) Put(part IncomingMessage) error {
 		})
 	case SimpleTextMessage:
 		// log.Print("incoming simple text message")
+		s.metrics.ReceivedParts++
 		if s.messageCallback == nil {
 			return nil
 		}
@@ -131,13 +746,52 @@ func (s *Stack) Put(part IncomingMessage) error {
 			0,
 			part.Header.Source,
 			part.Header.Destination,
-			time.Time{},
+			s.receivedTimestamp(time.Time{}),
 			1)
-		message.SetPart(1, payload.Text)
-		s.messageCallback(message)
+		message.SetPartWithTimestamp(1, payload.Text, s.receivedTimestamp(time.Time{}))
+		message.immediate = payload.Immediate()
+		s.metrics.CompletedMessages++
+		s.messageCallback(s.groupConversation(message))
+	case SDSReport:
+		if payload.AckRequired {
+			s.sendAck(part.Header, payload)
+		}
+		s.updateSentPart(part.Header.Source, payload.MessageReference, payload.DeliveryStatus)
+		if s.reportCallback == nil {
+			return nil
+		}
+		s.reportCallback(ReportMessage{
+			Source:           part.Header.Source,
+			Destination:      part.Header.Destination,
+			MessageReference: payload.MessageReference,
+			DeliveryStatus:   payload.DeliveryStatus,
+		})
+	case SDSShortReport:
+		s.updateSentPart(part.Header.Source, payload.MessageReference, payload.DeliveryStatus())
+		if s.reportCallback == nil {
+			return nil
+		}
+		s.reportCallback(ReportMessage{
+			Source:           part.Header.Source,
+			Destination:      part.Header.Destination,
+			MessageReference: payload.MessageReference,
+			DeliveryStatus:   payload.DeliveryStatus(),
+			Short:            true,
+		})
+	case SDS4Message, UnsupportedServiceMessage:
+		if s.dataCallback == nil {
+			return nil
+		}
+		s.dataCallback(DataMessage{
+			Source:      part.Header.Source,
+			Destination: part.Header.Destination,
+			Payload:     payload,
+		})
 	case SDSTransfer:
 		// log.Print("incoming SDS-TRANSFER")
 		return s.putSDSTransfer(part.Header, payload)
+	case SimpleConcatenatedTextMessage:
+		return s.putSimpleConcatenatedTextMessage(part.Header, payload)
 	default:
 		return fmt.Errorf("unexpected message type %T", payload)
 	}
@@ -145,59 +799,315 @@ func (s *Stack) Put(part IncomingMessage) error {
 	return nil
 }
 
+// sendReports sends the SDS-REPORTs that are requested for the given SDS-TRANSFER, according to the configured report options.
+func (s *Stack) sendReports(header Header, sdsTransfer SDSTransfer, consumed bool) {
+	if s.responseCallback == nil {
+		return
+	}
+
+	statuses := make([]DeliveryStatus, 0, 2)
+	if sdsTransfer.ReceivedReportRequested() {
+		statuses = append(statuses, s.reportOptions.receivedStatus)
+	}
+	if consumed && s.reportOptions.consumedEnabled && sdsTransfer.ConsumedReportRequested() {
+		statuses = append(statuses, s.reportOptions.consumedStatus)
+	}
+	if len(statuses) == 0 {
+		return
+	}
+
+	selection := s.currentService
+	commands := make([]string, 0, 2*len(statuses)+1)
+	for _, status := range statuses {
+		report, short := buildReport(sdsTransfer, s.reportOptions.ackRequired, status)
+		if short {
+			commands = append(commands, s.switchToService(&selection, StatusService, s.sendConfig.SendShortReport(header.Source, report.(SDSShortReport)))...)
+		} else {
+			commands = append(commands, s.switchToService(&selection, SDSTLService, s.sendConfig.SendMessage(header.Source, report))...)
+		}
+	}
+
+	s.respond(selection, s.restorePreviousService(&selection, s.currentService, commands))
+}
+
+// sendAck sends the SDS-ACK for the given SDS-REPORT, unless the same report was already acknowledged within the ack window.
+func (s *Stack) sendAck(header Header, sdsReport SDSReport) {
+	if s.responseCallback == nil {
+		return
+	}
+
+	now := s.clock.Now()
+	for key, acked := range s.ackedReports {
+		if now.Sub(acked) > s.ackWindow {
+			delete(s.ackedReports, key)
+		}
+	}
+
+	key := ackedReport{
+		source:           header.Source,
+		messageReference: sdsReport.MessageReference,
+		deliveryStatus:   sdsReport.DeliveryStatus,
+	}
+	if _, ok := s.ackedReports[key]; ok {
+		return
+	}
+	if s.ackWindow > 0 {
+		s.ackedReports[key] = now
+	}
+
+	selection := s.currentService
+	ack := NewSDSAcknowledge(sdsReport, ReceiptAckByDestination)
+	commands := s.switchToService(&selection, SDSTLService, s.sendConfig.SendMessage(header.Source, ack))
+	s.respond(selection, s.restorePreviousService(&selection, s.currentService, commands))
+}
+
 func (s *Stack) putSDSTransfer(header Header, sdsTransfer SDSTransfer) error {
 	var messageID int
 	var message Message
-	var ok bool
+	var err error
+
+	if lazy, ok := sdsTransfer.UserData.(LazyTextSDU); ok {
+		// the stack needs the text to assemble the message
+		sdsTransfer.UserData, err = lazy.TextSDU()
+		if err != nil {
+			return err
+		}
+	}
 
 	switch sdu := sdsTransfer.UserData.(type) {
 	case TextSDU:
+		s.metrics.ReceivedParts++
 		messageID = int(sdsTransfer.MessageReference)
 		message = NewMessage(
 			messageID,
 			header.Source,
 			header.Destination,
-			sdu.Timestamp,
+			s.receivedTimestamp(sdu.Timestamp),
 			1,
 		)
-		message.SetPart(1, sdu.Text)
-
-		if s.responseCallback != nil && sdsTransfer.ReceivedReportRequested() {
-			ackRequired := false // TODO should be configurable or a parameter
-			sdsReport := NewSDSReport(sdsTransfer, ackRequired, ReceiptAckByDestination)
-
-			s.responseCallback([]string{
-				SwitchToSDSTL,
-				SendMessage(header.Source, sdsReport),
-			})
+		message.SetPartWithTimestamp(1, sdu.Text, s.receivedTimestamp(sdu.Timestamp))
+		message.immediate = sdsTransfer.Immediate()
+		if sdsTransfer.StoreForwardControl.Valid && sdsTransfer.StoreForwardControl.ForwardAddressType == ForwardToExternalSubscriberNumber {
+			message.externalNumber = sdsTransfer.StoreForwardControl.ExternalSubscriberNumber
 		}
+		if s.messageCallback != nil {
+			message = s.groupConversation(message)
+		}
+
+		s.sendReports(header, sdsTransfer, s.messageCallback != nil)
 	case ConcatenatedTextSDU:
+		s.metrics.ReceivedParts++
 		messageID = int(sdu.UserDataHeader.MessageReference)
-		message, ok = s.pendingMessages[messageID]
-		if !ok {
-			message = NewMessage(
-				messageID,
-				header.Source,
-				header.Destination,
-				sdu.Timestamp,
-				int(sdu.UserDataHeader.TotalNumber),
-			)
-		} else if message.Source != header.Source ||
-			message.Destination != header.Destination ||
-			len(message.parts) != int(sdu.UserDataHeader.TotalNumber) {
-			return fmt.Errorf("part does not match message 0x%x: %s != %s | %s != %s | %d != %d", message.ID, message.Source, header.Source, message.Destination, header.Destination, len(message.parts), int(sdu.UserDataHeader.TotalNumber))
-		}
-		message.SetPart(int(sdu.UserDataHeader.SequenceNumber), sdu.Text)
+		key := MessageKey{
+			Source:      header.Source,
+			Destination: header.Destination,
+			Scheme:      sdu.UserDataHeader.ElementID,
+			Reference:   messageID,
+		}
+		message, err = s.pendingMessage(key, int(sdu.UserDataHeader.TotalNumber), sdu.Timestamp)
+		if err != nil {
+			return err
+		}
+		if message.hasPart(int(sdu.UserDataHeader.SequenceNumber)) {
+			s.metrics.DuplicatePartsSuppressed++
+			return nil
+		}
+		message.SetPartWithTimestamp(int(sdu.UserDataHeader.SequenceNumber), sdu.Text, s.receivedTimestamp(sdu.Timestamp))
+		if location, ok := sdu.Location(); ok {
+			message.SetLocation(location)
+		}
+	case nil:
+		// a SDS-TRANSFER without SDU carries nothing to deliver, only the requested reports are sent
+		s.sendReports(header, sdsTransfer, false)
+		return nil
 	default:
 		return fmt.Errorf("unexpected SDS-TRANSFER SDU: %T", sdu)
 	}
 
+	s.deliverOrKeep(message)
+	return nil
+}
+
+func (s *Stack) putSimpleConcatenatedTextMessage(header Header, part SimpleConcatenatedTextMessage) error {
+	s.metrics.ReceivedParts++
+	key := MessageKey{
+		Source:      header.Source,
+		Destination: header.Destination,
+		Scheme:      simpleConcatenationScheme,
+		Reference:   int(part.MessageReference),
+	}
+	message, err := s.pendingMessage(key, int(part.TotalNumber), time.Time{})
+	if err != nil {
+		return err
+	}
+	if message.hasPart(int(part.SequenceNumber)) {
+		s.metrics.DuplicatePartsSuppressed++
+		return nil
+	}
+	message.SetPartWithTimestamp(int(part.SequenceNumber), part.Text, s.receivedTimestamp(time.Time{}))
+
+	s.deliverOrKeep(message)
+	return nil
+}
+
+// simpleConcatenationScheme is used in the MessageKey of concatenated simple text messages to separate them
+// from concatenated text messages with user data header. It is not a valid UDH information element ID.
+const simpleConcatenationScheme UDHInformationElementID = 0xFF
+
+// pendingMessage returns the pending message with the given key, or a new message with the given total number of parts.
+// If the pending message has a different total number of parts, it is either restarted or discarded, depending on
+// the stack's configuration.
+func (s *Stack) pendingMessage(key MessageKey, totalNumber int, timestamp time.Time) (Message, error) {
+	message, ok := s.pendingMessages[key]
+	if ok && len(message.parts) == totalNumber {
+		return message, nil
+	}
+	if ok {
+		s.metrics.DiscardedIncomplete++
+	}
+	if ok && !s.restartOnTotalMismatch {
+		s.deletePending(key)
+		return Message{}, fmt.Errorf("part does not match message 0x%x, message discarded: %d != %d", message.ID, len(message.parts), totalNumber)
+	}
+
+	message = NewMessage(
+		key.Reference,
+		key.Source,
+		key.Destination,
+		s.receivedTimestamp(timestamp),
+		totalNumber,
+	)
+	message.scheme = key.Scheme
+	return message, nil
+}
+
+// deliverOrKeep delivers the given message if it is complete, otherwise the message is kept as pending message.
+func (s *Stack) deliverOrKeep(message Message) {
 	if message.Complete() && s.messageCallback != nil {
+		s.metrics.CompletedMessages++
 		s.messageCallback(message)
-		delete(s.pendingMessages, message.ID)
+		s.deletePending(message.Key())
 	} else {
-		s.pendingMessages[message.ID] = message
+		s.pendingMessages[message.Key()] = message
+		if s.pendingStore != nil {
+			s.pendingStore.Save(message)
+		}
 	}
+}
 
-	return nil
+func (s *Stack) deletePending(key MessageKey) {
+	delete(s.pendingMessages, key)
+	if s.pendingStore != nil {
+		s.pendingStore.Delete(key)
+	}
+}
+
+// SentMessage contains the delivery state of a message that was sent, see Stack.TrackSent.
+type SentMessage struct {
+	// ID is the reference of the message. For concatenated messages, this is the reference in the user data header.
+	ID          int
+	Destination tetra.Identity
+	Parts       []SentPart
+}
+
+// SentPart contains the delivery state of one part of a sent message.
+type SentPart struct {
+	MessageReference MessageReference
+	DeliveryStatus   DeliveryStatus
+	// Reported indicates if a report was received for this part.
+	Reported bool
+}
+
+// Delivered indicates if all parts of the message were reported as received or consumed by the destination.
+func (m SentMessage) Delivered() bool {
+	for _, part := range m.Parts {
+		if !part.Reported || (part.DeliveryStatus != ReceiptAckByDestination && part.DeliveryStatus != ConsumedByDestination) {
+			return false
+		}
+	}
+	return true
+}
+
+type sentMessageKey struct {
+	destination tetra.Identity
+	id          int
+}
+
+type sentPartKey struct {
+	destination      tetra.Identity
+	messageReference MessageReference
+}
+
+type sentPartIndex struct {
+	message sentMessageKey
+	index   int
+}
+
+// TrackSent lets the stack know that the given SDS-TRANSFER PDUs were sent to the given destination as one message.
+// The stack maps the message references of the parts to the message, so that incoming reports for the single parts
+// update the delivery state of the message (see SentMessage). It returns the ID of the tracked message.
+// The message is tracked until ForgetSent is called, also after it was delivered, or until a message with the same ID
+// is tracked for the same destination.
+func (s *Stack) TrackSent(destination tetra.Identity, transfers []SDSTransfer) int {
+	if len(transfers) == 0 {
+		return 0
+	}
+	id := int(transfers[0].MessageReference)
+	if sdu, ok := transfers[0].UserData.(ConcatenatedTextSDU); ok {
+		id = int(sdu.UserDataHeader.MessageReference)
+	}
+	key := sentMessageKey{destination: destination, id: id}
+	s.ForgetSent(destination, id)
+
+	message := SentMessage{
+		ID:          id,
+		Destination: destination,
+		Parts:       make([]SentPart, len(transfers)),
+	}
+	for i, transfer := range transfers {
+		message.Parts[i].MessageReference = transfer.MessageReference
+		s.sentParts[sentPartKey{destination: destination, messageReference: transfer.MessageReference}] = sentPartIndex{message: key, index: i}
+	}
+	s.sentMessages[key] = message
+	return id
+}
+
+// SentMessage returns a copy of the delivery state of the sent message with the given ID. Later reports do not
+// change the returned copy.
+func (s *Stack) SentMessage(destination tetra.Identity, id int) (SentMessage, bool) {
+	message, ok := s.sentMessages[sentMessageKey{destination: destination, id: id}]
+	if !ok {
+		return SentMessage{}, false
+	}
+	parts := make([]SentPart, len(message.Parts))
+	copy(parts, message.Parts)
+	message.Parts = parts
+	return message, true
+}
+
+// ForgetSent stops tracking the sent message with the given ID. Call this once the delivery state of the message
+// is not needed anymore, e.g. when it was delivered, since the stack keeps all tracked messages.
+func (s *Stack) ForgetSent(destination tetra.Identity, id int) {
+	key := sentMessageKey{destination: destination, id: id}
+	message, ok := s.sentMessages[key]
+	if !ok {
+		return
+	}
+	for _, part := range message.Parts {
+		partKey := sentPartKey{destination: destination, messageReference: part.MessageReference}
+		if s.sentParts[partKey].message == key {
+			delete(s.sentParts, partKey)
+		}
+	}
+	delete(s.sentMessages, key)
+}
+
+func (s *Stack) updateSentPart(source tetra.Identity, messageReference MessageReference, status DeliveryStatus) {
+	index, ok := s.sentParts[sentPartKey{destination: source, messageReference: messageReference}]
+	if !ok {
+		return
+	}
+	message := s.sentMessages[index.message]
+	message.Parts[index.index].DeliveryStatus = status
+	message.Parts[index.index].Reported = true
 }
@@ -1,13 +1,68 @@
 package sds
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/ftl/tetra-pei/tetra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// testClock is a Clock that returns the time it is set to.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// testTransfer returns an incoming SDS-TRANSFER with the given SDU from the given source to 2345678.
+func testTransfer(source tetra.Identity, messageReference MessageReference, sdu interface{}) IncomingMessage {
+	protocol := TextMessaging
+	if _, ok := sdu.(ConcatenatedTextSDU); ok {
+		protocol = UserDataHeaderMessaging
+	}
+	return IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: source, Destination: "2345678", PDUBits: 200},
+		Payload: SDSTransfer{
+			protocol:         protocol,
+			MessageReference: messageReference,
+			UserData:         sdu,
+		},
+	}
+}
+
+// testConcatenatedPart returns an incoming part of a concatenated ISO8859-1 text message from the given source
+// to 2345678 with the message reference 0xC9 in the user data header.
+func testConcatenatedPart(source tetra.Identity, messageReference MessageReference, totalNumber byte, sequenceNumber byte, text string, timestamp time.Time) IncomingMessage {
+	return testTransfer(source, messageReference, ConcatenatedTextSDU{
+		TextSDU: TextSDU{
+			TextHeader: TextHeader{
+				Encoding:     ISO8859_1,
+				HasTimestamp: !timestamp.IsZero(),
+				Timestamp:    timestamp,
+			},
+			Text: text,
+		},
+		UserDataHeader: ConcatenatedTextUDH{
+			HeaderLength:     5,
+			ElementID:        ConcatenatedTextMessageWithShortReference,
+			ElementLength:    3,
+			MessageReference: 0xC9,
+			TotalNumber:      totalNumber,
+			SequenceNumber:   sequenceNumber,
+		},
+	})
+}
+
 func TestStack_Put_Status(t *testing.T) {
 	value := IncomingMessage{
 		Header:  Header{AIService: StatusService, Source: "1234567", Destination: "2345678", PDUBits: 16},
@@ -33,6 +88,99 @@ func TestStack_Put_Status(t *testing.T) {
 	assert.Equal(t, expected, status)
 }
 
+func TestStack_Put_Data(t *testing.T) {
+	tt := []struct {
+		desc    string
+		service AIService
+		payload interface{}
+	}{
+		{desc: "SDS type 4", service: SDSTLService, payload: NewSDS4Message(0xC3, []byte{0x01, 0x02})},
+		{desc: "unsupported service", service: SDS1Service, payload: UnsupportedServiceMessage{Service: SDS1Service, Raw: []byte{0x12, 0x34}}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			value := IncomingMessage{
+				Header:  Header{AIService: tc.service, Source: "1234567", Destination: "2345678", PDUBits: 16},
+				Payload: tc.payload,
+			}
+			expected := DataMessage{
+				Source:      "1234567",
+				Destination: "2345678",
+				Payload:     tc.payload,
+			}
+
+			var data []DataMessage
+			stack := NewStack().WithDataCallback(func(d DataMessage) {
+				data = append(data, d)
+			})
+
+			err := stack.Put(value)
+
+			require.NoError(t, err)
+			assert.Equal(t, []DataMessage{expected}, data)
+		})
+	}
+}
+
+func TestStack_Put_Report(t *testing.T) {
+	tt := []struct {
+		desc     string
+		value    IncomingMessage
+		expected ReportMessage
+	}{
+		{
+			desc: "SDS-REPORT",
+			value: IncomingMessage{
+				Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 32},
+				Payload: SDSReport{
+					protocol:         TextMessaging,
+					DeliveryStatus:   ConsumedByDestination,
+					MessageReference: 0xC9,
+				},
+			},
+			expected: ReportMessage{
+				Source:           "1234567",
+				Destination:      "2345678",
+				MessageReference: 0xC9,
+				DeliveryStatus:   ConsumedByDestination,
+			},
+		},
+		{
+			desc: "SDS-SHORT-REPORT on status service",
+			value: IncomingMessage{
+				Header: Header{AIService: StatusService, Source: "1234567", Destination: "2345678", PDUBits: 16},
+				Payload: SDSShortReport{
+					ReportType:       MessageReceivedShort,
+					MessageReference: 0xCA,
+				},
+			},
+			expected: ReportMessage{
+				Source:           "1234567",
+				Destination:      "2345678",
+				MessageReference: 0xCA,
+				DeliveryStatus:   ReceiptAckByDestination,
+				Short:            true,
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			var report ReportMessage
+			reportReceived := false
+			stack := NewStack().WithReportCallback(func(r ReportMessage) {
+				report = r
+				reportReceived = true
+			})
+
+			err := stack.Put(tc.value)
+
+			require.NoError(t, err)
+			assert.True(t, reportReceived)
+			assert.Equal(t, tc.expected, report)
+		})
+	}
+}
+
 func TestStack_Put_SimpleTextMessage(t *testing.T) {
 	value := IncomingMessage{
 		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 224},
@@ -85,7 +233,7 @@ func TestStack_Put_TextMessage(t *testing.T) {
 		Destination: "2345678",
 		Timestamp:   time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local),
 		parts: []part{
-			{Valid: true, Text: "testmessage"},
+			{Valid: true, Text: "testmessage", Timestamp: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)},
 		},
 	}
 
@@ -103,6 +251,21 @@ func TestStack_Put_TextMessage(t *testing.T) {
 	assert.Equal(t, expected, message)
 }
 
+func TestStack_Put_LazyTextMessage(t *testing.T) {
+	value, err := ParseIncomingMessageWithOptions("+CTSDSR: 12,1234567,0,2345678,0,81", "8200C900E9979F4D3BB380", WithLazyText())
+	require.NoError(t, err)
+
+	var message Message
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		message = m
+	})
+
+	err = stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, "testing", message.Text())
+}
+
 func TestStack_Put_SinglePartConcatenatedMessage(t *testing.T) {
 	value := IncomingMessage{
 		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 192},
@@ -134,7 +297,7 @@ func TestStack_Put_SinglePartConcatenatedMessage(t *testing.T) {
 		Destination: "2345678",
 		Timestamp:   time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local),
 		parts: []part{
-			{Valid: true, Text: "testmessage"},
+			{Valid: true, Text: "testmessage", Timestamp: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)},
 		},
 	}
 
@@ -209,8 +372,8 @@ func TestStack_Put_MultiPartConcatenatedMessage(t *testing.T) {
 		Destination: "2345678",
 		Timestamp:   time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local),
 		parts: []part{
-			{Valid: true, Text: "testmessage1"},
-			{Valid: true, Text: "\ntestmessage2"},
+			{Valid: true, Text: "testmessage1", Timestamp: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)},
+			{Valid: true, Text: "\ntestmessage2", Timestamp: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)},
 		},
 	}
 
@@ -230,6 +393,39 @@ func TestStack_Put_MultiPartConcatenatedMessage(t *testing.T) {
 	assert.Equal(t, expected, message)
 }
 
+func TestStack_Put_Report_AckRequiredOnlyOnce(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 32},
+		Payload: SDSReport{
+			protocol:         TextMessaging,
+			AckRequired:      true,
+			DeliveryStatus:   ConsumedByDestination,
+			MessageReference: 0xC9,
+		},
+	}
+	clock := &testClock{now: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)}
+
+	responses := make([][]string, 0)
+	stack := NewStack().
+		WithClock(clock).
+		WithResponseCallback(func(s []string) error {
+			responses = append(responses, s)
+			return nil
+		})
+
+	require.NoError(t, stack.Put(value))
+	require.NoError(t, stack.Put(value))
+
+	expected := [][]string{{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32\r\n822000C9\x1a"}}
+	assert.Equal(t, expected, responses)
+
+	clock.Advance(DefaultAckWindow + time.Second)
+	require.NoError(t, stack.Put(value))
+
+	assert.Len(t, responses, 2)
+	assert.Equal(t, []string{"AT+CMGS=1234567,32\r\n822000C9\x1a"}, responses[1])
+}
+
 func TestStack_Put_TextMessage_ReceiptReportRequested(t *testing.T) {
 	value := IncomingMessage{
 		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
@@ -262,3 +458,962 @@ func TestStack_Put_TextMessage_ReceiptReportRequested(t *testing.T) {
 	assert.True(t, responseReceived)
 	assert.Equal(t, expected, responses)
 }
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_SendConfig(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1},
+				Text:       "testmessage",
+			},
+		},
+	}
+	expected := []string{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32\r821000C9\x1a"}
+
+	var responses []string
+	stack := NewStack().
+		WithSendConfig(SendConfig{CommandTerminator: "\r", DataTerminator: CtrlZ}).
+		WithResponseCallback(func(s []string) error {
+			responses = s
+			return nil
+		})
+
+	err := stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, responses)
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_WithoutE2EE(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1},
+				Text:       "testmessage",
+			},
+		},
+	}
+	expected := []string{"AT+CTSDS=12,0,0,0,0", "AT+CMGS=1234567,32\r\n821000C9\x1a"}
+
+	var responses []string
+	stack := NewStack().
+		WithE2EE(false).
+		WithResponseCallback(func(s []string) error {
+			responses = s
+			return nil
+		})
+
+	err := stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, responses)
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_WithServiceRestore(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1},
+				Text:       "testmessage",
+			},
+		},
+	}
+	expected := []string{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32\r\n821000C9\x1a", "AT+CTSDS=13,0"}
+
+	var responses []string
+	stack := NewStack().
+		WithServiceRestore(true).
+		WithResponseCallback(func(s []string) error {
+			responses = s
+			return nil
+		})
+	stack.SetCurrentService(StatusService)
+
+	err := stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, responses)
+
+	// the restored service is the current service again, hence the next report switches again
+	err = stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, responses)
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_WithServiceRestore_SameService(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1},
+				Text:       "testmessage",
+			},
+		},
+	}
+	expected := []string{"AT+CMGS=1234567,32\r\n821000C9\x1a"}
+
+	var responses []string
+	stack := NewStack().
+		WithServiceRestore(true).
+		WithResponseCallback(func(s []string) error {
+			responses = s
+			return nil
+		})
+	stack.SetCurrentService(SDSTLService)
+
+	err := stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, responses)
+}
+
+func TestStack_Put_OverlappingConcatenatedMessagesFromDifferentSources(t *testing.T) {
+	values := []IncomingMessage{
+		testConcatenatedPart("1234567", 0xC9, 2, 1, "first1", time.Time{}),
+		testConcatenatedPart("7654321", 0xC9, 2, 1, "second1", time.Time{}),
+		testConcatenatedPart("7654321", 0xCA, 2, 2, "second2", time.Time{}),
+		testConcatenatedPart("1234567", 0xCA, 2, 2, "first2", time.Time{}),
+	}
+
+	messages := make(map[tetra.Identity]Message)
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		messages[m.Source] = m
+	})
+
+	for i, value := range values {
+		err := stack.Put(value)
+		require.NoErrorf(t, err, "part %d", i)
+	}
+
+	require.Equal(t, 2, len(messages))
+	assert.Equal(t, "first1first2", messages["1234567"].Text())
+	assert.Equal(t, "second1second2", messages["7654321"].Text())
+	assert.Equal(t, MessageKey{Source: "1234567", Destination: "2345678", Scheme: ConcatenatedTextMessageWithShortReference, Reference: 0xC9}, messages["1234567"].Key())
+	assert.Empty(t, stack.pendingMessages)
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_AlreadyInSDSTL(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{
+					Encoding: ISO8859_1,
+				},
+				Text: "testmessage",
+			},
+		},
+	}
+	expected := []string{"AT+CMGS=1234567,32\r\n821000C9\x1a"}
+
+	responses := make([]string, 0)
+	stack := NewStack().WithResponseCallback(func(s []string) error {
+		responses = s
+		return nil
+	})
+	stack.SetCurrentService(SDSTLService)
+
+	err := stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, responses)
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_SwitchOnlyOnce(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{
+					Encoding: ISO8859_1,
+				},
+				Text: "testmessage",
+			},
+		},
+	}
+
+	responses := make([][]string, 0)
+	stack := NewStack().WithResponseCallback(func(s []string) error {
+		responses = append(responses, s)
+		return nil
+	})
+	stack.SetCurrentService(StatusService)
+
+	require.NoError(t, stack.Put(value))
+	require.NoError(t, stack.Put(value))
+
+	require.Equal(t, 2, len(responses))
+	assert.Equal(t, []string{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32\r\n821000C9\x1a"}, responses[0])
+	assert.Equal(t, []string{"AT+CMGS=1234567,32\r\n821000C9\x1a"}, responses[1])
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_SwitchAgainAfterFailure(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1},
+				Text:       "testmessage",
+			},
+		},
+	}
+	expected := []string{"AT+CTSDS=12,0,0,0,1", "AT+CMGS=1234567,32\r\n821000C9\x1a"}
+
+	responses := make([][]string, 0)
+	stack := NewStack().WithResponseCallback(func(s []string) error {
+		responses = append(responses, s)
+		if len(responses) == 1 {
+			return fmt.Errorf("+CME ERROR: 1")
+		}
+		return nil
+	})
+	stack.SetCurrentService(StatusService)
+
+	require.NoError(t, stack.Put(value))
+	require.NoError(t, stack.Put(value))
+	require.NoError(t, stack.Put(value))
+
+	require.Equal(t, 3, len(responses))
+	assert.Equal(t, expected, responses[0])
+	assert.Equal(t, expected, responses[1])
+	assert.Equal(t, expected[1:], responses[2])
+}
+
+func TestStack_Put_TextMessage_ReceiptReportRequested_SwitchE2EEVariant(t *testing.T) {
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:              TextMessaging,
+			MessageReference:      0xC9,
+			DeliveryReportRequest: MessageReceivedReportRequested,
+			UserData: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1},
+				Text:       "testmessage",
+			},
+		},
+	}
+
+	var responses []string
+	stack := NewStack().WithResponseCallback(func(s []string) error {
+		responses = s
+		return nil
+	})
+	stack.SetCurrentService(SDSTLService)
+	stack.WithE2EE(false)
+
+	require.NoError(t, stack.Put(value))
+
+	assert.Equal(t, []string{"AT+CTSDS=12,0,0,0,0", "AT+CMGS=1234567,32\r\n821000C9\x1a"}, responses)
+}
+
+func TestStack_Put_MultiPartConcatenatedMessage_EarliestTimestamp(t *testing.T) {
+	earlier := time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)
+	later := earlier.Add(time.Minute)
+
+	var message Message
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		message = m
+	})
+
+	require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xCA, 2, 2, "testmessage", earlier)))
+	require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 2, 1, "testmessage", later)))
+
+	assert.Equal(t, earlier, message.Timestamp)
+	assert.Equal(t, []time.Time{later, earlier}, message.PartTimestamps())
+}
+
+func TestStack_Put_TextMessageWithoutTimestamp(t *testing.T) {
+	now := time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)
+	value := IncomingMessage{
+		Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+		Payload: SDSTransfer{
+			protocol:         TextMessaging,
+			MessageReference: 0xC9,
+			UserData: TextSDU{
+				TextHeader: TextHeader{
+					Encoding: ISO8859_1,
+				},
+				Text: "testmessage",
+			},
+		},
+	}
+
+	tt := []struct {
+		desc          string
+		stampReceived bool
+		expected      time.Time
+	}{
+		{desc: "zero time by default", stampReceived: false, expected: time.Time{}},
+		{desc: "time of reception", stampReceived: true, expected: now},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			var message Message
+			stack := NewStack().
+				WithClock(&testClock{now: now}).
+				WithReceivedTimestamps(tc.stampReceived).
+				WithMessageCallback(func(m Message) {
+					message = m
+				})
+
+			err := stack.Put(value)
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, message.Timestamp)
+			assert.Equal(t, []time.Time{tc.expected}, message.PartTimestamps())
+		})
+	}
+}
+
+func TestStack_Put_SimpleTextMessageWithReceivedTimestamp(t *testing.T) {
+	now := time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)
+	value := IncomingMessage{
+		Header:  Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 112},
+		Payload: NewSimpleTextMessage(false, ISO8859_1, "testmessage"),
+	}
+
+	var message Message
+	stack := NewStack().
+		WithClock(&testClock{now: now}).
+		WithReceivedTimestamps(true).
+		WithMessageCallback(func(m Message) {
+			message = m
+		})
+
+	err := stack.Put(value)
+
+	require.NoError(t, err)
+	assert.Equal(t, now, message.Timestamp)
+}
+
+func TestStack_Put_TextMessage_ReportOptions(t *testing.T) {
+	tt := []struct {
+		desc                  string
+		deliveryReportRequest DeliveryReportRequest
+		configure             func(*Stack) *Stack
+		expected              []string
+	}{
+		{
+			desc:                  "default, received requested",
+			deliveryReportRequest: MessageReceivedReportRequested,
+			configure:             func(s *Stack) *Stack { return s },
+			expected:              []string{"AT+CMGS=1234567,32\r\n821000C9\x1a"},
+		},
+		{
+			desc:                  "default, consumed requested",
+			deliveryReportRequest: MessageConsumedReportRequested,
+			configure:             func(s *Stack) *Stack { return s },
+			expected:              nil,
+		},
+		{
+			desc:                  "ack required, memory full",
+			deliveryReportRequest: MessageReceivedReportRequested,
+			configure: func(s *Stack) *Stack {
+				return s.WithReportOptions(true, DestinationMemoryFull, ConsumedByDestination)
+			},
+			expected: []string{"AT+CMGS=1234567,32\r\n821860C9\x1a"},
+		},
+		{
+			desc:                  "received and consumed requested",
+			deliveryReportRequest: MessageReceivedAndConsumedReportRequested,
+			configure: func(s *Stack) *Stack {
+				return s.WithReportOptions(false, ReceiptAckByDestination, ConsumedByDestination)
+			},
+			expected: []string{"AT+CMGS=1234567,32\r\n821000C9\x1a", "AT+CMGS=1234567,32\r\n821002C9\x1a"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			value := IncomingMessage{
+				Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678", PDUBits: 120},
+				Payload: SDSTransfer{
+					protocol:              TextMessaging,
+					MessageReference:      0xC9,
+					DeliveryReportRequest: tc.deliveryReportRequest,
+					UserData: TextSDU{
+						TextHeader: TextHeader{
+							Encoding: ISO8859_1,
+						},
+						Text: "testmessage",
+					},
+				},
+			}
+
+			var responses []string
+			stack := tc.configure(NewStack()).
+				WithMessageCallback(func(Message) {}).
+				WithResponseCallback(func(s []string) error {
+					responses = s
+					return nil
+				})
+			stack.SetCurrentService(SDSTLService)
+
+			err := stack.Put(value)
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, responses)
+		})
+	}
+}
+
+func TestStack_Put_ConcatenatedMessage_TotalNumberMismatch(t *testing.T) {
+
+	t.Run("discard", func(t *testing.T) {
+		var messages []Message
+		stack := NewStack().WithMessageCallback(func(m Message) {
+			messages = append(messages, m)
+		})
+
+		require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 3, 1, "part1", time.Time{})))
+		assert.Error(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 2, 2, "part2", time.Time{})))
+		assert.Empty(t, stack.pendingMessages)
+
+		require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 2, 1, "part1", time.Time{})))
+		require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 2, 2, "part2", time.Time{})))
+		require.Len(t, messages, 1)
+		assert.Equal(t, "part1part2", messages[0].Text())
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		var messages []Message
+		stack := NewStack().WithRestartOnTotalMismatch(true).WithMessageCallback(func(m Message) {
+			messages = append(messages, m)
+		})
+
+		require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 3, 1, "part1", time.Time{})))
+		require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 2, 2, "part2", time.Time{})))
+		assert.Empty(t, messages)
+
+		require.NoError(t, stack.Put(testConcatenatedPart("1234567", 0xC9, 2, 1, "part1", time.Time{})))
+		require.Len(t, messages, 1)
+		assert.Equal(t, "part1part2", messages[0].Text())
+		assert.Empty(t, stack.pendingMessages)
+	})
+}
+
+func TestStack_Put_ConversationGrouping(t *testing.T) {
+	simpleText := func(source tetra.Identity, text string) IncomingMessage {
+		return IncomingMessage{
+			Header: Header{AIService: SDSTLService, Source: source, Destination: "2345678", PDUBits: 104},
+			Payload: SimpleTextMessage{
+				protocol: SimpleTextMessaging,
+				Encoding: ISO8859_1,
+				Text:     text,
+			},
+		}
+	}
+	clock := &testClock{now: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)}
+
+	var messages []Message
+	stack := NewStack().
+		WithClock(clock).
+		WithConversationGrouping(time.Minute).
+		WithMessageCallback(func(m Message) {
+			messages = append(messages, m)
+		})
+
+	require.NoError(t, stack.Put(simpleText("1234567", "hello")))
+	clock.Advance(30 * time.Second)
+	require.NoError(t, stack.Put(simpleText("1234567", " world")))
+	require.NoError(t, stack.Put(simpleText("3456789", "other")))
+	clock.Advance(2 * time.Minute)
+	require.NoError(t, stack.Put(simpleText("1234567", "later")))
+
+	require.Len(t, messages, 4)
+	assert.Equal(t, "hello", messages[0].Text())
+	assert.Equal(t, "hello world", messages[1].Text())
+	assert.Equal(t, 2, len(messages[1].parts))
+	assert.True(t, messages[1].Complete())
+	assert.Equal(t, "other", messages[2].Text())
+	assert.Equal(t, "later", messages[3].Text())
+}
+
+func TestStack_Put_ConversationGroupingExpiryAndLimit(t *testing.T) {
+	simpleText := func(source tetra.Identity, text string) IncomingMessage {
+		return IncomingMessage{
+			Header:  Header{AIService: SDSTLService, Source: source, Destination: "2345678", PDUBits: 104},
+			Payload: NewSimpleTextMessage(false, ISO8859_1, text),
+		}
+	}
+	clock := &testClock{now: time.Date(2021, time.April, 11, 10, 15, 0, 0, time.Local)}
+
+	var messages []Message
+	stack := NewStack().
+		WithClock(clock).
+		WithConversationGrouping(time.Minute).
+		WithConversationLimit(2).
+		WithMessageCallback(func(m Message) {
+			messages = append(messages, m)
+		})
+
+	require.NoError(t, stack.Put(simpleText("1234567", "a")))
+	require.NoError(t, stack.Put(simpleText("1234567", "b")))
+	require.NoError(t, stack.Put(simpleText("1234567", "c")))
+	require.NoError(t, stack.Put(simpleText("1234567", "d")))
+	require.NoError(t, stack.Put(simpleText("3456789", "other")))
+	assert.Len(t, stack.conversations, 2)
+
+	clock.Advance(2 * time.Minute)
+	require.NoError(t, stack.Put(simpleText("1234567", "e")))
+
+	texts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		texts = append(texts, m.Text())
+	}
+	assert.Equal(t, []string{"a", "ab", "c", "cd", "other", "e"}, texts)
+	assert.Len(t, stack.conversations, 1, "expired conversations are evicted")
+}
+
+func TestMessage_ToTransfers(t *testing.T) {
+	firstTimestamp := time.Date(time.Now().Year(), time.April, 11, 10, 15, 0, 0, time.UTC)
+	secondTimestamp := time.Date(time.Now().Year(), time.April, 11, 10, 16, 0, 0, time.UTC)
+	message := NewMessage(0xC9, "1234567", "2345678", firstTimestamp, 2)
+	message.SetPartWithTimestamp(1, "testmessage1", firstTimestamp)
+	message.SetPartWithTimestamp(2, "testmessage2", secondTimestamp)
+
+	transfers := message.ToTransfers(0x10, 1184)
+	require.Len(t, transfers, 2)
+
+	var forwarded Message
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		forwarded = m
+	})
+	for i, transfer := range transfers {
+		pdu, bits := transfer.Encode(nil, 0)
+		incoming, err := ParseIncomingMessage(fmt.Sprintf("+CTSDSR: 12,2345678,0,3456789,0,%d", bits), tetra.BinaryToHex(pdu))
+		require.NoErrorf(t, err, "part %d", i)
+		require.NoErrorf(t, stack.Put(incoming), "part %d", i)
+	}
+
+	assert.Equal(t, 0x10, forwarded.ID)
+	assert.Equal(t, message.Text(), forwarded.Text())
+	assert.Equal(t, firstTimestamp, forwarded.Timestamp)
+	assert.Equal(t, []time.Time{firstTimestamp, secondTimestamp}, forwarded.PartTimestamps())
+}
+
+func TestMessage_ToTransfers_SplitLongParts(t *testing.T) {
+	message := NewMessage(0xC9, "1234567", "2345678", time.Time{}, 2)
+	message.SetPart(1, "testmessage1")
+	message.SetPart(2, "testmessage2")
+
+	transfers := message.ToTransfers(0x10, 144)
+
+	texts := make([]string, 0, len(transfers))
+	for _, transfer := range transfers {
+		pdu, bits := transfer.Encode(nil, 0)
+		assert.LessOrEqual(t, bits, 144)
+		assert.Equal(t, len(pdu)*8, bits)
+		texts = append(texts, transfer.UserData.(ConcatenatedTextSDU).Text)
+	}
+	assert.Equal(t, []string{"testmess", "age1", "testmess", "age2"}, texts)
+}
+
+func TestMessage_ToTransfers_ReferenceWrapsAround(t *testing.T) {
+	message := NewMessage(0xC9, "1234567", "2345678", time.Time{}, 2)
+	message.SetPart(1, "testmessage1")
+	message.SetPart(2, "testmessage2")
+
+	transfers := message.ToTransfers(0xFF, 1184)
+
+	require.Len(t, transfers, 2)
+	assert.Equal(t, MessageReference(0xFF), transfers[0].MessageReference)
+	assert.Equal(t, MessageReference(0xFF).Offset(1), transfers[1].MessageReference)
+	assert.Equal(t, MessageReference(0x00), transfers[1].MessageReference)
+}
+
+func TestStack_Put_SimpleConcatenatedTextMessage(t *testing.T) {
+	pdus := []string{
+		"0CC9020201746573746D65737361676532",
+		"0CC9020101746573746D65737361676531",
+	}
+
+	var messages []Message
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		messages = append(messages, m)
+	})
+
+	for i, pdu := range pdus {
+		part, err := ParseIncomingMessage("+CTSDSR: 12,1234567,0,2345678,0,136", pdu)
+		require.NoErrorf(t, err, "part %d", i)
+		require.NoErrorf(t, stack.Put(part), "part %d", i)
+	}
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, 0xC9, messages[0].ID)
+	assert.Equal(t, "testmessage1testmessage2", messages[0].Text())
+	assert.True(t, messages[0].Timestamp.IsZero())
+	assert.Empty(t, stack.pendingMessages)
+}
+
+func TestStack_Put_ImmediateMessages(t *testing.T) {
+	tt := []struct {
+		desc     string
+		pdu      string
+		bits     int
+		expected bool
+	}{
+		{desc: "simple text message", pdu: "0201746573746D657373616765", bits: 104},
+		{desc: "simple immediate text message", pdu: "0901746573746D657373616765", bits: 104, expected: true},
+		{desc: "text message", pdu: "8200C901746573746D657373616765", bits: 120},
+		{desc: "immediate text message", pdu: "8900C901746573746D657373616765", bits: 120, expected: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			var message Message
+			stack := NewStack().WithMessageCallback(func(m Message) {
+				message = m
+			})
+
+			part, err := ParseIncomingMessage(fmt.Sprintf("+CTSDSR: 12,1234567,0,2345678,0,%d", tc.bits), tc.pdu)
+			require.NoError(t, err)
+			require.NoError(t, stack.Put(part))
+
+			assert.Equal(t, "testmessage", message.Text())
+			assert.Equal(t, tc.expected, message.Immediate())
+		})
+	}
+}
+
+func TestStack_Put_MessageKind(t *testing.T) {
+	sdu := ConcatenatedTextSDU{
+		TextSDU: TextSDU{
+			TextHeader: TextHeader{Encoding: ISO8859_1},
+			Text:       "testmessage",
+		},
+		UserDataHeader: ConcatenatedTextUDH{
+			ElementID:        ConcatenatedTextMessageWithShortReference,
+			MessageReference: 0xC9,
+			TotalNumber:      1,
+			SequenceNumber:   1,
+		},
+	}
+	withLocation := sdu
+	withLocation.UserDataHeader.OtherElements = []UDHInformationElement{
+		{ID: 0x71, Data: []byte("$GPGLL,4901.2345,N,01012.3456,E")},
+	}
+
+	tt := []struct {
+		desc     string
+		sdu      ConcatenatedTextSDU
+		expected MessageKind
+	}{
+		{desc: "text", sdu: sdu, expected: TextMessageKind},
+		{desc: "location", sdu: withLocation, expected: LocationMessageKind},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			var message Message
+			stack := NewStack().WithMessageCallback(func(m Message) {
+				message = m
+			})
+
+			err := stack.Put(IncomingMessage{
+				Header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678"},
+				Payload: SDSTransfer{
+					protocol:         UserDataHeaderMessaging,
+					MessageReference: 0xC9,
+					UserData:         tc.sdu,
+				},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, message.Kind())
+		})
+	}
+}
+
+func TestStack_Put_PendingStore(t *testing.T) {
+	transfers := NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, 128, "testmessage1testmessage2")
+	require.Greater(t, len(transfers), 1)
+	header := Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678"}
+
+	store := NewInMemoryPendingStore()
+	stack := NewStack().WithPendingStore(store)
+	for _, transfer := range transfers[:len(transfers)-1] {
+		require.NoError(t, stack.Put(IncomingMessage{Header: header, Payload: transfer}))
+	}
+	require.Len(t, store.Load(), 1)
+
+	var message Message
+	messageReceived := false
+	restored := NewStack().
+		WithPendingStore(store).
+		WithMessageCallback(func(m Message) {
+			message = m
+			messageReceived = true
+		})
+	require.NoError(t, restored.Put(IncomingMessage{Header: header, Payload: transfers[len(transfers)-1]}))
+
+	assert.True(t, messageReceived)
+	assert.Equal(t, "testmessage1testmessage2", message.Text())
+	assert.Empty(t, restored.pendingMessages)
+	assert.Empty(t, store.Load())
+}
+
+// jsonPendingStore keeps the pending messages serialized as JSON.
+type jsonPendingStore struct {
+	messages map[MessageKey][]byte
+}
+
+func (s *jsonPendingStore) Save(message Message) {
+	data, err := json.Marshal(message.Snapshot())
+	if err != nil {
+		panic(err)
+	}
+	s.messages[message.Key()] = data
+}
+
+func (s *jsonPendingStore) Delete(key MessageKey) {
+	delete(s.messages, key)
+}
+
+func (s *jsonPendingStore) Load() []Message {
+	result := make([]Message, 0, len(s.messages))
+	for _, data := range s.messages {
+		var snapshot MessageSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			panic(err)
+		}
+		result = append(result, NewMessageFromSnapshot(snapshot))
+	}
+	return result
+}
+
+func TestStack_Put_SerializingPendingStore(t *testing.T) {
+	timestamp := time.Date(2021, time.April, 11, 10, 15, 0, 0, time.UTC)
+	transfers := NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, 128, "testmessage1testmessage2")
+	require.Greater(t, len(transfers), 1)
+	for i, transfer := range transfers {
+		sdu := transfer.UserData.(ConcatenatedTextSDU)
+		sdu.TextHeader = NewTextHeaderWithTimestamp(sdu.Encoding, timestamp)
+		transfers[i].UserData = sdu
+	}
+	header := Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678"}
+
+	store := &jsonPendingStore{messages: make(map[MessageKey][]byte)}
+	stack := NewStack().WithPendingStore(store)
+	for _, transfer := range transfers[:len(transfers)-1] {
+		require.NoError(t, stack.Put(IncomingMessage{Header: header, Payload: transfer}))
+	}
+	pending := store.Load()
+	require.Len(t, pending, 1)
+	assert.Equal(t, stack.pendingMessages[pending[0].Key()], pending[0])
+
+	var message Message
+	messageReceived := false
+	restored := NewStack().
+		WithPendingStore(store).
+		WithMessageCallback(func(m Message) {
+			message = m
+			messageReceived = true
+		})
+	require.NoError(t, restored.Put(IncomingMessage{Header: header, Payload: transfers[len(transfers)-1]}))
+
+	assert.True(t, messageReceived)
+	assert.Equal(t, "testmessage1testmessage2", message.Text())
+	assert.Equal(t, timestamp, message.Timestamp)
+	assert.Empty(t, store.messages)
+}
+
+func TestMessage_Snapshot(t *testing.T) {
+	timestamp := time.Date(2021, time.April, 11, 10, 15, 0, 0, time.UTC)
+	message := NewMessage(0xC9, "1234567", "2345678", timestamp, 3)
+	message.scheme = ConcatenatedTextMessageWithShortReference
+	message.SetPartWithTimestamp(2, "part2", timestamp)
+	message.SetLocation(Location{Latitude: 51.5, Longitude: 7.25})
+	message.immediate = true
+
+	snapshot := message.Snapshot()
+
+	assert.Equal(t, []MessagePart{{}, {Valid: true, Text: "part2", Timestamp: timestamp}, {}}, snapshot.Parts)
+	assert.Equal(t, &Location{Latitude: 51.5, Longitude: 7.25}, snapshot.Location)
+	assert.Equal(t, message, NewMessageFromSnapshot(snapshot))
+}
+
+func TestStack_Put_InterleavedConcatenatedMessages(t *testing.T) {
+	type sent struct {
+		header    Header
+		text      string
+		transfers []SDSTransfer
+	}
+	messages := []sent{
+		{header: Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678"}, text: "first message from the first source"},
+		{header: Header{AIService: SDSTLService, Source: "3456789", Destination: "2345678"}, text: "first message from the second source"},
+		{header: Header{AIService: SDSTLService, Source: "1234567", Destination: "4567890"}, text: "message to another destination"},
+	}
+	for i := range messages {
+		messages[i].transfers = NewConcatenatedMessageTransfer(0xC9, NoReportRequested, ISO8859_1, 128, messages[i].text)
+		require.Greater(t, len(messages[i].transfers), 2)
+	}
+
+	received := make(map[tetra.Identity]map[tetra.Identity]string)
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		if _, ok := received[m.Source]; !ok {
+			received[m.Source] = make(map[tetra.Identity]string)
+		}
+		received[m.Source][m.Destination] = m.Text()
+	})
+
+	// deliver the parts interleaved, in reverse order within each message
+	for done := false; !done; {
+		done = true
+		for i := range messages {
+			count := len(messages[i].transfers)
+			if count == 0 {
+				continue
+			}
+			done = false
+			require.Empty(t, received[messages[i].header.Source][messages[i].header.Destination])
+			require.NoError(t, stack.Put(IncomingMessage{Header: messages[i].header, Payload: messages[i].transfers[count-1]}))
+			messages[i].transfers = messages[i].transfers[:count-1]
+		}
+	}
+
+	for _, m := range messages {
+		assert.Equal(t, m.text, received[m.header.Source][m.header.Destination])
+	}
+	assert.Empty(t, stack.pendingMessages)
+}
+
+func TestStack_Metrics(t *testing.T) {
+	header := Header{AIService: SDSTLService, Source: "1234567", Destination: "2345678"}
+	part := func(messageReference MessageReference, totalNumber byte, sequenceNumber byte, text string) IncomingMessage {
+		return IncomingMessage{
+			Header: header,
+			Payload: SimpleConcatenatedTextMessage{
+				protocol:         SimpleConcatenatedSDSMessaging,
+				MessageReference: messageReference,
+				TotalNumber:      totalNumber,
+				SequenceNumber:   sequenceNumber,
+				Encoding:         ISO8859_1,
+				Text:             text,
+			},
+		}
+	}
+	values := []IncomingMessage{
+		{
+			Header: header,
+			Payload: SDSTransfer{
+				protocol:         TextMessaging,
+				MessageReference: 0xC8,
+				UserData:         TextSDU{TextHeader: TextHeader{Encoding: ISO8859_1}, Text: "single"},
+			},
+		},
+		part(0xC9, 2, 1, "complete1"),
+		part(0xC9, 2, 1, "complete1"),
+		part(0xC9, 2, 2, "complete2"),
+		part(0xCA, 3, 1, "incomplete1"),
+		part(0xCA, 2, 2, "mismatch2"),
+		part(0xCB, 2, 1, "pending1"),
+		{Header: header, Payload: 42},
+	}
+
+	var messages []Message
+	stack := NewStack().WithMessageCallback(func(m Message) {
+		messages = append(messages, m)
+	})
+	for _, value := range values {
+		stack.Put(value)
+	}
+
+	assert.Len(t, messages, 2)
+	assert.Equal(t, StackMetrics{
+		ReceivedParts:            7,
+		CompletedMessages:        2,
+		DiscardedIncomplete:      1,
+		DuplicatePartsSuppressed: 1,
+		Errors:                   2,
+	}, stack.Metrics())
+}
+
+func TestStack_TrackSent_ReportsForParts(t *testing.T) {
+	transfers := NewConcatenatedMessageTransfer(0xFE, MessageReceivedReportRequested, ISO8859_1, 128, "first second third")
+	require.Len(t, transfers, 3)
+	report := func(messageReference MessageReference, status DeliveryStatus) IncomingMessage {
+		return IncomingMessage{
+			Header:  Header{AIService: SDSTLService, Source: "2345678", Destination: "1234567"},
+			Payload: SDSReport{protocol: UserDataHeaderMessaging, DeliveryStatus: status, MessageReference: messageReference},
+		}
+	}
+
+	stack := NewStack()
+	id := stack.TrackSent("2345678", transfers)
+	assert.Equal(t, 0xFE, id)
+
+	require.NoError(t, stack.Put(report(0x00, ReceiptAckByDestination)))
+	require.NoError(t, stack.Put(report(0xFE, ReceiptAckByDestination)))
+	require.NoError(t, stack.Put(IncomingMessage{
+		Header:  Header{AIService: StatusService, Source: "2345678", Destination: "1234567"},
+		Payload: SDSShortReport{ReportType: DestinationMemoryFullShort, MessageReference: 0xFF},
+	}))
+
+	message, ok := stack.SentMessage("2345678", id)
+	require.True(t, ok)
+	assert.Equal(t, []SentPart{
+		{MessageReference: 0xFE, DeliveryStatus: ReceiptAckByDestination, Reported: true},
+		{MessageReference: 0xFF, DeliveryStatus: DestinationMemoryFull, Reported: true},
+		{MessageReference: 0x00, DeliveryStatus: ReceiptAckByDestination, Reported: true},
+	}, message.Parts)
+	assert.False(t, message.Delivered())
+
+	require.NoError(t, stack.Put(report(0xFF, ReceiptAckByDestination)))
+	message, _ = stack.SentMessage("2345678", id)
+	assert.True(t, message.Delivered())
+
+	// reports from other sources do not match
+	require.NoError(t, stack.Put(IncomingMessage{
+		Header:  Header{AIService: SDSTLService, Source: "7654321", Destination: "1234567"},
+		Payload: SDSReport{protocol: UserDataHeaderMessaging, DeliveryStatus: DeliveryFailed, MessageReference: 0xFE},
+	}))
+	message, _ = stack.SentMessage("2345678", id)
+	assert.True(t, message.Delivered())
+
+	stack.ForgetSent("2345678", id)
+	_, ok = stack.SentMessage("2345678", id)
+	assert.False(t, ok)
+}
+
+func TestStack_SentMessage_ReturnsCopy(t *testing.T) {
+	transfers := NewConcatenatedMessageTransfer(0xFE, MessageReceivedReportRequested, ISO8859_1, 128, "first second third")
+	stack := NewStack()
+	id := stack.TrackSent("2345678", transfers)
+
+	before, ok := stack.SentMessage("2345678", id)
+	require.True(t, ok)
+	before.Parts[1].Reported = true
+
+	require.NoError(t, stack.Put(IncomingMessage{
+		Header:  Header{AIService: SDSTLService, Source: "2345678", Destination: "1234567"},
+		Payload: SDSReport{protocol: UserDataHeaderMessaging, DeliveryStatus: ReceiptAckByDestination, MessageReference: 0xFE},
+	}))
+
+	assert.False(t, before.Parts[0].Reported)
+	after, _ := stack.SentMessage("2345678", id)
+	assert.True(t, after.Parts[0].Reported)
+	assert.False(t, after.Parts[1].Reported)
+}
@@ -0,0 +1,67 @@
+package sds
+
+import (
+	"github.com/ftl/tetra-pei/tetra"
+)
+
+// StatusExchangeCallback is called when a response status is received for a request status that was sent before.
+type StatusExchangeCallback func(request StatusMessage, response StatusMessage)
+
+// StatusExchange correlates sent request status values with the response status values received from their destination.
+// Only one request per destination can await its response, a newer request replaces the pending one.
+type StatusExchange struct {
+	exchangeCallback StatusExchangeCallback
+	pending          map[tetra.Identity]StatusMessage
+}
+
+func NewStatusExchange() *StatusExchange {
+	return &StatusExchange{
+		pending: make(map[tetra.Identity]StatusMessage),
+	}
+}
+
+func (e *StatusExchange) WithExchangeCallback(callback StatusExchangeCallback) *StatusExchange {
+	e.exchangeCallback = callback
+	return e
+}
+
+// Sent lets the exchange know that the given request status was sent to the given destination.
+// Status values that are not requests are ignored.
+func (e *StatusExchange) Sent(destination tetra.Identity, status Status) {
+	if status.Direction() != StatusRequest {
+		return
+	}
+	e.pending[destination] = StatusMessage{
+		Destination: destination,
+		Value:       status,
+	}
+}
+
+// Pending returns the request that awaits its response from the given destination.
+func (e *StatusExchange) Pending(destination tetra.Identity) (StatusMessage, bool) {
+	request, ok := e.pending[destination]
+	return request, ok
+}
+
+// Cancel stops waiting for the response from the given destination.
+func (e *StatusExchange) Cancel(destination tetra.Identity) {
+	delete(e.pending, destination)
+}
+
+// Put correlates the given received status message with the pending request to its source. It returns true if the
+// status message is the response to a pending request. Call Put from the StatusCallback of the Stack.
+func (e *StatusExchange) Put(message StatusMessage) bool {
+	if message.Direction() != StatusResponse {
+		return false
+	}
+	request, ok := e.pending[message.Source]
+	if !ok {
+		return false
+	}
+	delete(e.pending, message.Source)
+
+	if e.exchangeCallback != nil {
+		e.exchangeCallback(request, message)
+	}
+	return true
+}
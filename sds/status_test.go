@@ -0,0 +1,35 @@
+package sds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusExchange(t *testing.T) {
+	var request, response StatusMessage
+	exchanged := 0
+	exchange := NewStatusExchange().WithExchangeCallback(func(req StatusMessage, resp StatusMessage) {
+		request = req
+		response = resp
+		exchanged++
+	})
+
+	exchange.Sent("1234567", Status2)
+	_, pending := exchange.Pending("1234567")
+	assert.True(t, pending)
+
+	assert.False(t, exchange.Put(StatusMessage{Source: "2345678", Destination: "3456789", Value: StatusA}), "other source")
+	assert.False(t, exchange.Put(StatusMessage{Source: "1234567", Destination: "3456789", Value: Status0}), "request")
+	assert.Equal(t, 0, exchanged)
+
+	received := StatusMessage{Source: "1234567", Destination: "3456789", Value: StatusA}
+	assert.True(t, exchange.Put(received))
+	assert.Equal(t, 1, exchanged)
+	assert.Equal(t, StatusMessage{Destination: "1234567", Value: Status2}, request)
+	assert.Equal(t, received, response)
+
+	_, pending = exchange.Pending("1234567")
+	assert.False(t, pending)
+	assert.False(t, exchange.Put(received), "already answered")
+}
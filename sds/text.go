@@ -3,11 +3,14 @@ package sds
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 /* Text related types and functions */
@@ -47,6 +50,28 @@ const (
 	VISCII
 )
 
+// encodingLanguages contains the ISO 639-1 language codes of the text encoding schemes that are specific for one language.
+var encodingLanguages = map[TextEncoding]string{
+	ISO8859_6:   "ar",
+	ISO8859_7:   "el",
+	ISO8859_8:   "he",
+	ISO8859_9:   "tr",
+	CodePage737: "el",
+	CodePage857: "tr",
+	CodePage860: "pt",
+	CodePage861: "is",
+	CodePage863: "fr",
+	CodePage869: "el",
+	VISCII:      "vi",
+}
+
+// Language returns a best-effort hint for the language of a text in this encoding as ISO 639-1 code. The text header
+// according to [AI] 29.5.4 contains no language indication, hence the hint is derived from encoding schemes that are
+// specific for one language. For all other encoding schemes, the result is empty.
+func (e TextEncoding) Language() string {
+	return encodingLanguages[e]
+}
+
 // TextCodecs contains encoding.Encoding instances for all supported text encoding schemes.
 // Beware that not all defined schemes are actually supported here.
 var TextCodecs = map[TextEncoding]encoding.Encoding{
@@ -74,8 +99,21 @@ var TextCodecs = map[TextEncoding]encoding.Encoding{
 	UTF16BE:     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
 }
 
+// DefaultFallbackEncoding is used by the package level functions if a text encoding is not supported.
+const DefaultFallbackEncoding = ISO8859_1
+
 var fallbackCodec encoding.Encoding = charmap.ISO8859_1 // be lenient and use ISO8859-1 as fallback if anything goes havoc
 
+// fallbackCodecFor returns the codec for the given fallback encoding, or the default fallback codec if the given
+// fallback encoding is not supported either.
+func fallbackCodecFor(fallback TextEncoding) encoding.Encoding {
+	codec, ok := TextCodecs[fallback]
+	if !ok {
+		return fallbackCodec
+	}
+	return codec
+}
+
 // EncodingByName maps allows to access all the supported encodings by their name as string
 var EncodingByName = map[string]TextEncoding{
 	"ISO8859-1":   ISO8859_1,
@@ -158,6 +196,45 @@ func SplitToMaxBits(encoding TextEncoding, maxPDUBits int, text string) []string
 	return result
 }
 
+// ChooseEncoding returns the encoding from the given list of preferred encodings that represents the given text
+// with the least number of bits. If two encodings need the same number of bits, the one that comes first in the list wins.
+// Packed7Bit is a candidate if all characters of the text are part of the GSM 7-bit alphabet, other encodings
+// without a codec in TextCodecs are skipped. If none of the preferred encodings is able to represent
+// the text, UTF16BE is used.
+func ChooseEncoding(text string, preferred []TextEncoding) TextEncoding {
+	result := UTF16BE
+	resultBits := -1
+	for _, candidate := range preferred {
+		bits, ok := encodedTextBits(text, candidate)
+		if !ok {
+			continue
+		}
+		if resultBits == -1 || bits < resultBits {
+			result = candidate
+			resultBits = bits
+		}
+	}
+	return result
+}
+
+// encodedTextBits returns the number of bits of the given text in the given encoding, if the encoding is able to
+// represent all characters of the text.
+func encodedTextBits(text string, encoding TextEncoding) (int, bool) {
+	if encoding == Packed7Bit {
+		septets, complete := encodeGSM7Bit(text)
+		return len(septets) * 7, complete
+	}
+	codec, ok := TextCodecs[encoding]
+	if !ok {
+		return 0, false
+	}
+	encodedBytes, err := codec.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return 0, false
+	}
+	return TextBytesToBits(encoding, len(encodedBytes)), true
+}
+
 // ParseTextHeader in text messages and concatenated text messages.
 func ParseTextHeader(bytes []byte) (TextHeader, error) {
 	if len(bytes) < 1 {
@@ -181,6 +258,26 @@ func ParseTextHeader(bytes []byte) (TextHeader, error) {
 		}
 	}
 	result.Timestamp = timestamp
+	result.HasTimestamp = timestampUsed
+
+	return result, nil
+}
+
+// ParseTextHeaderWithCharacterCount parses a text header that carries an explicit number of characters
+// in the octet following the (optional) timestamp. This form is used by some radios. Since the text header
+// contains no indication of this field, the caller must know which form to expect.
+func ParseTextHeaderWithCharacterCount(bytes []byte) (TextHeader, error) {
+	result, err := ParseTextHeader(bytes)
+	if err != nil {
+		return TextHeader{}, err
+	}
+
+	countIndex := result.Length()
+	if len(bytes) <= countIndex {
+		return TextHeader{}, fmt.Errorf("text header with character count too short: %d", len(bytes))
+	}
+	result.CharacterCount = int(bytes[countIndex])
+	result.HasCharacterCount = true
 
 	return result, nil
 }
@@ -188,48 +285,266 @@ func ParseTextHeader(bytes []byte) (TextHeader, error) {
 // TextHeader represents the meta information for text used in text messages according to [AI] 29.5.3.3
 // and concatenated text messages according to [AI] 29.5.10.3
 type TextHeader struct {
-	Encoding  TextEncoding
-	Timestamp time.Time
+	Encoding TextEncoding
+
+	// HasTimestamp indicates that the header contains a timestamp. Timestamp is only encoded if HasTimestamp is set.
+	HasTimestamp bool
+	Timestamp    time.Time
+
+	// HasCharacterCount indicates that the header carries the number of characters in the text.
+	HasCharacterCount bool
+	CharacterCount    int
+}
+
+// NewTextHeader returns a new text header with the given encoding and no timestamp.
+func NewTextHeader(encoding TextEncoding) TextHeader {
+	return TextHeader{
+		Encoding: encoding,
+	}
+}
+
+// NewTextHeaderWithTimestamp returns a new text header with the given encoding and timestamp.
+func NewTextHeaderWithTimestamp(encoding TextEncoding, timestamp time.Time) TextHeader {
+	return TextHeader{
+		Encoding:     encoding,
+		HasTimestamp: true,
+		Timestamp:    timestamp,
+	}
+}
+
+// Language returns a best-effort hint for the language of the text, derived from the encoding (see TextEncoding.Language).
+func (h TextHeader) Language() string {
+	return h.Encoding.Language()
+}
+
+// TimestampUsed indicates if the timestamp is part of the encoded header.
+func (h TextHeader) TimestampUsed() bool {
+	return h.HasTimestamp
+}
+
+// CharacterCountUsed indicates if the number of characters is part of the encoded header.
+func (h TextHeader) CharacterCountUsed() bool {
+	return h.HasCharacterCount
+}
+
+// limitText limits the given text to the number of characters carried by this header.
+func (h TextHeader) limitText(text string) string {
+	if !h.HasCharacterCount {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) > h.CharacterCount {
+		return string(runes[:h.CharacterCount])
+	}
+	return text
 }
 
 // Encode this text header
 func (h TextHeader) Encode(bytes []byte, bits int) ([]byte, int) {
 	bytes = append(bytes, byte(h.Encoding))
 	bits += 8
-	if !h.Timestamp.IsZero() {
+	if h.TimestampUsed() {
 		bytes[len(bytes)-1] |= 0x80
 		bytes = append(bytes, EncodeTimestampUTC(h.Timestamp)...)
 		bits += 24
 	}
+	if h.CharacterCountUsed() {
+		bytes = append(bytes, byte(h.CharacterCount))
+		bits += 8
+	}
 
 	return bytes, bits
 }
 
 // Length returns the length of this text header in bytes.
 func (h TextHeader) Length() int {
-	if h.Timestamp.IsZero() {
-		return 1
+	result := 1
+	if h.TimestampUsed() {
+		result += 3
 	}
-	return 4
+	if h.CharacterCountUsed() {
+		result++
+	}
+	return result
 }
 
 // DecodePayloadText decodes the actual text content using the given encoding scheme according to [AI] 29.5.4
 func DecodePayloadText(textEncoding TextEncoding, bytes []byte) (string, error) {
+	return DecodePayloadTextBits(textEncoding, bytes, len(bytes)*8)
+}
+
+// DecodePayloadTextBits works like DecodePayloadText, but decodes only the given number of meaningful bits.
+// This is relevant for the Packed7Bit encoding, where the last byte may contain padding bits that must not be
+// decoded as an additional character.
+func DecodePayloadTextBits(textEncoding TextEncoding, bytes []byte, bits int) (string, error) {
+	return decodePayloadText(textEncoding, bytes, bits, fallbackCodec)
+}
+
+// DecodePayloadTextWithFallback works like DecodePayloadText, but uses the given fallback encoding
+// instead of DefaultFallbackEncoding if the text encoding is not supported.
+func DecodePayloadTextWithFallback(textEncoding TextEncoding, bytes []byte, fallback TextEncoding) (string, error) {
+	return decodePayloadText(textEncoding, bytes, len(bytes)*8, fallbackCodecFor(fallback))
+}
+
+func decodePayloadText(textEncoding TextEncoding, bytes []byte, bits int, fallback encoding.Encoding) (string, error) {
+	if textEncoding == Packed7Bit {
+		return decodePacked7Bit(bytes, bits), nil
+	}
+
+	if unitSize, ok := codeUnitSizes[textEncoding]; ok && len(bytes)%unitSize != 0 {
+		return "", &TruncatedTextError{Encoding: textEncoding, Length: len(bytes), UnitSize: unitSize}
+	}
+
 	var decoder *encoding.Decoder
 	codec, ok := TextCodecs[textEncoding]
 	if ok {
 		decoder = codec.NewDecoder()
 	} else { // we have no matching codec, but be lenient and use the fallback
-		decoder = fallbackCodec.NewDecoder()
+		decoder = fallback.NewDecoder()
 	}
 
 	utf8, err := decoder.Bytes(bytes)
 	return string(utf8), err
 }
 
+// codeUnitSizes contains the size in bytes of the fixed code units of multi-byte text encodings.
+var codeUnitSizes = map[TextEncoding]int{
+	UTF16BE: 2,
+}
+
+// TruncatedTextError indicates that an encoded text is not a whole number of code units of its multi-byte encoding,
+// i.e. the text was truncated.
+type TruncatedTextError struct {
+	Encoding TextEncoding
+	Length   int
+	UnitSize int
+}
+
+func (e *TruncatedTextError) Error() string {
+	return fmt.Sprintf("truncated text: %d bytes are not a multiple of the %d byte code unit of encoding 0x%02x", e.Length, e.UnitSize, byte(e.Encoding))
+}
+
+// decodePacked7Bit decodes the septets of a packed 7-bit text, most significant bit first, using the
+// GSM 7-bit default alphabet. Only the given number of bits is decoded.
+func decodePacked7Bit(bytes []byte, bits int) string {
+	if bits < 0 || bits > len(bytes)*8 {
+		bits = len(bytes) * 8
+	}
+
+	septets := make([]byte, 0, bits/7)
+	for i := 0; i+7 <= bits; i += 7 {
+		var septet byte
+		for j := i; j < i+7; j++ {
+			bit := (bytes[j/8] >> (7 - j%8)) & 0x01
+			septet = (septet << 1) | bit
+		}
+		septets = append(septets, septet)
+	}
+
+	result := make([]rune, 0, len(septets))
+	for i := 0; i < len(septets); i++ {
+		if septets[i] == gsm7BitEscape && i+1 < len(septets) {
+			if r, ok := gsm7BitExtension[septets[i+1]]; ok {
+				result = append(result, r)
+				i++
+				continue
+			}
+		}
+		result = append(result, gsm7BitAlphabet[septets[i]])
+	}
+	return string(result)
+}
+
+const gsm7BitEscape = 0x1B
+
+var gsm7BitAlphabet = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\u00a0ÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+var gsm7BitExtension = map[byte]rune{
+	0x0A: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2F: '\\',
+	0x3C: '[',
+	0x3D: '~',
+	0x3E: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+// appendPacked7Bit packs the septets of the given text, most significant bit first, using the GSM 7-bit default
+// alphabet. It is the counterpart of decodePacked7Bit. Only the bits of the septets are counted, the padding bits
+// of the last byte are not.
+func appendPacked7Bit(bytes []byte, bits int, text string) ([]byte, int) {
+	septets, _ := encodeGSM7Bit(text)
+	packedBits := len(septets) * 7
+
+	start := len(bytes)
+	bytes = append(bytes, make([]byte, (packedBits+7)/8)...)
+	for i, septet := range septets {
+		for j := 0; j < 7; j++ {
+			if septet&(0x40>>j) == 0 {
+				continue
+			}
+			position := i*7 + j
+			bytes[start+position/8] |= 0x80 >> (position % 8)
+		}
+	}
+
+	return bytes, bits + packedBits
+}
+
+// encodeGSM7Bit returns the septets of the given text in the GSM 7-bit default alphabet. Characters of the extension
+// table are escaped, characters that cannot be represented are replaced by '?'. The result indicates if all
+// characters could be represented.
+func encodeGSM7Bit(text string) ([]byte, bool) {
+	result := make([]byte, 0, len(text))
+	complete := true
+	for _, r := range text {
+		if septet, ok := gsm7BitSeptets[r]; ok {
+			result = append(result, septet)
+		} else if septet, ok := gsm7BitExtensionSeptets[r]; ok {
+			result = append(result, gsm7BitEscape, septet)
+		} else {
+			result = append(result, gsm7BitSeptets['?'])
+			complete = false
+		}
+	}
+	return result, complete
+}
+
+var gsm7BitSeptets, gsm7BitExtensionSeptets = buildGSM7BitSeptets()
+
+func buildGSM7BitSeptets() (map[rune]byte, map[rune]byte) {
+	septets := make(map[rune]byte, len(gsm7BitAlphabet))
+	for i, r := range gsm7BitAlphabet {
+		if _, ok := septets[r]; !ok {
+			septets[r] = byte(i)
+		}
+	}
+	extensionSeptets := make(map[rune]byte, len(gsm7BitExtension))
+	for septet, r := range gsm7BitExtension {
+		extensionSeptets[r] = septet
+	}
+	return septets, extensionSeptets
+}
+
 // AppendEncodedPayloadText encodes the given payload text using the given text encoding and appends the result to the given byte slice.
 func AppendEncodedPayloadText(bytes []byte, bits int, text string, textEncoding TextEncoding) ([]byte, int) {
-	var encodedBytes []byte
+	return appendEncodedPayloadText(bytes, bits, text, textEncoding, fallbackCodec)
+}
+
+// AppendEncodedPayloadTextWithFallback works like AppendEncodedPayloadText, but uses the given fallback encoding
+// instead of DefaultFallbackEncoding if the text encoding is not supported.
+func AppendEncodedPayloadTextWithFallback(bytes []byte, bits int, text string, textEncoding TextEncoding, fallback TextEncoding) ([]byte, int) {
+	return appendEncodedPayloadText(bytes, bits, text, textEncoding, fallbackCodecFor(fallback))
+}
+
+func appendEncodedPayloadText(bytes []byte, bits int, text string, textEncoding TextEncoding, fallback encoding.Encoding) ([]byte, int) {
+	if textEncoding == Packed7Bit {
+		return appendPacked7Bit(bytes, bits, text)
+	}
+
 	var encodedBits int
 	var err error
 
@@ -238,20 +553,43 @@ func AppendEncodedPayloadText(bytes []byte, bits int, text string, textEncoding
 	if ok {
 		encoder = codec.NewEncoder()
 	} else { // we have no matching codec, but be lenient and use the fallback
-		encoder = fallbackCodec.NewEncoder()
+		encoder = fallback.NewEncoder()
 	}
 
-	encodedBytes, err = encoder.Bytes([]byte(text))
+	// encode directly into the given buffer to avoid an intermediate allocation
+	start := len(bytes)
+	bytes, _, err = transform.Append(encoder, bytes, []byte(text))
 	if err != nil { // something went wrong, but be lenient and use the fallback
-		encodedBytes = []byte(text)
+		bytes = append(bytes[:start], text...)
 	}
-	encodedBits = len(encodedBytes) * 8
+	encodedBits = (len(bytes) - start) * 8
 
-	bytes = append(bytes, encodedBytes...)
 	bits += encodedBits
 	return bytes, bits
 }
 
+// EncodedPayloadTextBits returns the number of bits that AppendEncodedPayloadText appends for the given text and encoding.
+func EncodedPayloadTextBits(text string, textEncoding TextEncoding) int {
+	if textEncoding == Packed7Bit {
+		septets, _ := encodeGSM7Bit(text)
+		return len(septets) * 7
+	}
+
+	var encoder *encoding.Encoder
+	codec, ok := TextCodecs[textEncoding]
+	if ok {
+		encoder = codec.NewEncoder()
+	} else {
+		encoder = fallbackCodec.NewEncoder()
+	}
+
+	encodedBytes, err := encoder.Bytes([]byte(text))
+	if err != nil {
+		return len(text) * 8
+	}
+	return len(encodedBytes) * 8
+}
+
 var leadingOPTA = regexp.MustCompile(`^[A-Za-z ]+#[0-9]{16}`)
 
 func SplitLeadingOPTA(s string) (string, string) {
@@ -264,17 +602,50 @@ func RemoveLeadingOPTA(s string) string {
 	return result
 }
 
-var trailingITSI = regexp.MustCompile(`((\x1a\x00)|(\x0d\x0d))([0-9]{16})$`)
+var (
+	itsiTerminatorsLock sync.RWMutex
+	itsiTerminators     = []string{"\x1a\x00", "\x0d\x0d"}
+	trailingITSI        = buildTrailingITSIExpression(itsiTerminators)
+)
+
+// RegisterITSITerminator adds the given byte sequence to the terminators that separate a trailing ITSI from the text.
+// Use this if a radio's firmware uses a terminator that is not known yet.
+func RegisterITSITerminator(terminator string) {
+	if terminator == "" {
+		return
+	}
+	itsiTerminatorsLock.Lock()
+	defer itsiTerminatorsLock.Unlock()
+
+	for _, t := range itsiTerminators {
+		if t == terminator {
+			return
+		}
+	}
+	itsiTerminators = append(itsiTerminators, terminator)
+	trailingITSI = buildTrailingITSIExpression(itsiTerminators)
+}
+
+func buildTrailingITSIExpression(terminators []string) *regexp.Regexp {
+	quoted := make([]string, len(terminators))
+	for i, terminator := range terminators {
+		quoted[i] = regexp.QuoteMeta(terminator)
+	}
+	return regexp.MustCompile(`(?:` + strings.Join(quoted, "|") + `)([0-9]{16})$`)
+}
 
 func SplitTrailingITSI(s string) (string, string) {
+	itsiTerminatorsLock.RLock()
 	groups := trailingITSI.FindStringSubmatch(s)
+	itsiTerminatorsLock.RUnlock()
+
 	var itsi string
 	var matchLen int
 	if len(groups) == 0 {
 		itsi = ""
 		matchLen = 0
 	} else {
-		itsi = groups[len(groups)-1]
+		itsi = groups[1]
 		matchLen = len(groups[0])
 	}
 	return s[0 : len(s)-matchLen], itsi
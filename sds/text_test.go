@@ -2,8 +2,10 @@ package sds
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBitsToTextBytes(t *testing.T) {
@@ -185,3 +187,341 @@ func TestSplitTrailingITSI(t *testing.T) {
 		})
 	}
 }
+
+func TestChooseEncoding(t *testing.T) {
+	tt := []struct {
+		desc      string
+		text      string
+		preferred []TextEncoding
+		expected  TextEncoding
+	}{
+		{
+			desc:      "pure ASCII",
+			text:      "testmessage",
+			preferred: []TextEncoding{ISO8859_1, UTF16BE},
+			expected:  ISO8859_1,
+		},
+		{
+			desc:      "pure ASCII, prefer the most compact",
+			text:      "testmessage",
+			preferred: []TextEncoding{UTF16BE, ISO8859_15},
+			expected:  ISO8859_15,
+		},
+		{
+			desc:      "pure ASCII, prefer 7-bit",
+			text:      "testmessage",
+			preferred: []TextEncoding{ISO8859_1, Packed7Bit, UTF16BE},
+			expected:  Packed7Bit,
+		},
+		{
+			desc:      "GSM alphabet with umlauts and extension characters",
+			text:      "Grüße {€}",
+			preferred: []TextEncoding{Packed7Bit, UTF16BE},
+			expected:  Packed7Bit,
+		},
+		{
+			desc:      "characters outside of the GSM alphabet",
+			text:      "test тест",
+			preferred: []TextEncoding{Packed7Bit, ISO8859_5},
+			expected:  ISO8859_5,
+		},
+		{
+			desc:      "unsupported encodings are skipped",
+			text:      "testmessage",
+			preferred: []TextEncoding{VISCII, ISO8859_1},
+			expected:  ISO8859_1,
+		},
+		{
+			desc:      "latin with umlauts",
+			text:      "Grüße",
+			preferred: []TextEncoding{ISO8859_1, UTF16BE},
+			expected:  ISO8859_1,
+		},
+		{
+			desc:      "mixed latin and cyrillic",
+			text:      "test тест",
+			preferred: []TextEncoding{ISO8859_1, ISO8859_5, UTF16BE},
+			expected:  ISO8859_5,
+		},
+		{
+			desc:      "mixed latin and greek without matching preference",
+			text:      "test αβγ",
+			preferred: []TextEncoding{ISO8859_1, ISO8859_5},
+			expected:  UTF16BE,
+		},
+		{
+			desc:     "no preferences",
+			text:     "testmessage",
+			expected: UTF16BE,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual := ChooseEncoding(tc.text, tc.preferred)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestParseTextSDUWithCharacterCount(t *testing.T) {
+	expectedTimestamp := time.Date(time.Now().Year(), time.April, 11, 8, 15, 0, 0, time.UTC)
+	tt := []struct {
+		desc     string
+		bytes    []byte
+		expected TextSDU
+		invalid  bool
+	}{
+		{
+			desc:  "without timestamp",
+			bytes: []byte{0x01, 0x04, 0x74, 0x65, 0x73, 0x74, 0x00, 0x00},
+			expected: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1, CharacterCount: 4, HasCharacterCount: true},
+				Text:       "test",
+			},
+		},
+		{
+			desc:  "with timestamp",
+			bytes: []byte{0x81, 0x44, 0x5A, 0x0F, 0x04, 0x74, 0x65, 0x73, 0x74},
+			expected: TextSDU{
+				TextHeader: TextHeader{Encoding: ISO8859_1, HasTimestamp: true, Timestamp: expectedTimestamp, CharacterCount: 4, HasCharacterCount: true},
+				Text:       "test",
+			},
+		},
+		{
+			desc:    "missing character count",
+			bytes:   []byte{0x01},
+			invalid: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := ParseTextSDUWithCharacterCount(tc.bytes)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.True(t, actual.CharacterCountUsed())
+
+			encoded, _ := actual.Encode([]byte{}, 0)
+			assert.Equal(t, actual.Length(), len(encoded))
+		})
+	}
+}
+
+func TestTextHeader_ExplicitTimestamp(t *testing.T) {
+	zeroTime := time.Time{}
+	tt := []struct {
+		desc          string
+		header        TextHeader
+		expectedBytes []byte
+		expectedBits  int
+	}{
+		{
+			desc:          "no timestamp",
+			header:        NewTextHeader(ISO8859_1),
+			expectedBytes: []byte{0x01},
+			expectedBits:  8,
+		},
+		{
+			desc:          "timestamp at zero time",
+			header:        NewTextHeaderWithTimestamp(ISO8859_1, zeroTime),
+			expectedBytes: []byte{0x81, 0x41, 0x08, 0x00},
+			expectedBits:  32,
+		},
+		{
+			desc:          "timestamp without HasTimestamp",
+			header:        TextHeader{Encoding: ISO8859_1, Timestamp: time.Date(2021, time.April, 11, 8, 15, 0, 0, time.UTC)},
+			expectedBytes: []byte{0x01},
+			expectedBits:  8,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actualBytes, actualBits := tc.header.Encode([]byte{}, 0)
+			assert.Equal(t, tc.expectedBytes, actualBytes)
+			assert.Equal(t, tc.expectedBits, actualBits)
+			assert.Equal(t, len(tc.expectedBytes), tc.header.Length())
+
+			parsed, err := ParseTextHeader(append(actualBytes, 0x00, 0x00, 0x00))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.header.HasTimestamp, parsed.HasTimestamp)
+			assert.Equal(t, tc.header.Length(), parsed.Length())
+		})
+	}
+}
+
+func TestDecodePayloadText_TruncatedUTF16BE(t *testing.T) {
+	_, err := DecodePayloadText(UTF16BE, []byte{0x04, 0x42, 0x04})
+
+	var truncated *TruncatedTextError
+	require.ErrorAs(t, err, &truncated)
+	assert.Equal(t, 3, truncated.Length)
+	assert.Equal(t, 2, truncated.UnitSize)
+
+	text, err := DecodePayloadText(UTF16BE, []byte{0x04, 0x42, 0x04, 0x35})
+	assert.NoError(t, err)
+	assert.Equal(t, "те", text)
+}
+
+func TestAppendEncodedPayloadText_Packed7BitRoundTrip(t *testing.T) {
+	tt := []struct {
+		text     string
+		expected []byte
+		bits     int
+	}{
+		{text: "testing", expected: []byte{0xE9, 0x97, 0x9F, 0x4D, 0x3B, 0xB3, 0x80}, bits: 49},
+		{text: "@A€", expected: []byte{0x01, 0x04, 0xDE, 0x50}, bits: 28},
+		{text: "hello", expected: []byte{0xD1, 0x97, 0x66, 0xCD, 0xE0}, bits: 35},
+	}
+	for _, tc := range tt {
+		t.Run(tc.text, func(t *testing.T) {
+			encoded, bits := AppendEncodedPayloadText(nil, 0, tc.text, Packed7Bit)
+			assert.Equal(t, tc.expected, encoded)
+			assert.Equal(t, tc.bits, bits)
+			assert.Equal(t, tc.bits, EncodedPayloadTextBits(tc.text, Packed7Bit))
+
+			decoded, err := DecodePayloadTextBits(Packed7Bit, encoded, bits)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.text, decoded)
+		})
+	}
+}
+
+func TestDecodePayloadTextBits_Packed7Bit(t *testing.T) {
+	tt := []struct {
+		desc     string
+		bytes    []byte
+		bits     int
+		expected string
+	}{
+		{
+			desc:     "exact bit count",
+			bytes:    []byte{0xE9, 0x97, 0x9F, 0x4D, 0x3B, 0xB3, 0x80},
+			bits:     49,
+			expected: "testing",
+		},
+		{
+			desc:     "padding decoded without bit count",
+			bytes:    []byte{0xE9, 0x97, 0x9F, 0x4D, 0x3B, 0xB3, 0x80},
+			bits:     56,
+			expected: "testing@",
+		},
+		{
+			desc:     "GSM alphabet and extension",
+			bytes:    []byte{0x01, 0x04, 0xDE, 0x50},
+			bits:     28,
+			expected: "@A€",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := DecodePayloadTextBits(Packed7Bit, tc.bytes, tc.bits)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestPayloadTextWithFallback(t *testing.T) {
+	bytes := []byte{0x74, 0x65, 0x73, 0x74, 0xE4}
+
+	latin1, err := DecodePayloadTextWithFallback(VISCII, bytes, ISO8859_1)
+	assert.NoError(t, err)
+	assert.Equal(t, "testä", latin1)
+
+	cp437, err := DecodePayloadTextWithFallback(VISCII, bytes, CodePage437)
+	assert.NoError(t, err)
+	assert.Equal(t, "testΣ", cp437)
+
+	unsupported, err := DecodePayloadTextWithFallback(VISCII, bytes, CodePage737)
+	assert.NoError(t, err)
+	assert.Equal(t, "testä", unsupported)
+
+	encoded, bits := AppendEncodedPayloadTextWithFallback(nil, 0, "testΣ", VISCII, CodePage437)
+	assert.Equal(t, bytes, encoded)
+	assert.Equal(t, 40, bits)
+
+	sdu, err := ParseTextSDUWithFallback(append([]byte{byte(VISCII)}, bytes...), CodePage437)
+	assert.NoError(t, err)
+	assert.Equal(t, "testΣ", sdu.Text)
+}
+
+func TestRegisterITSITerminator(t *testing.T) {
+	defaultTerminators := itsiTerminators
+	defer func() {
+		itsiTerminators = defaultTerminators
+		trailingITSI = buildTrailingITSIExpression(itsiTerminators)
+	}()
+
+	value := "testmessage*#1234567890123456"
+	head, itsi := SplitTrailingITSI(value)
+	assert.Equal(t, value, head)
+	assert.Equal(t, "", itsi)
+
+	RegisterITSITerminator("*#")
+	RegisterITSITerminator("*#")
+	assert.Len(t, itsiTerminators, len(defaultTerminators)+1)
+
+	head, itsi = SplitTrailingITSI(value)
+	assert.Equal(t, "testmessage", head)
+	assert.Equal(t, "1234567890123456", itsi)
+
+	head, itsi = SplitTrailingITSI("testmessage\r\r1234567890123456")
+	assert.Equal(t, "testmessage", head)
+	assert.Equal(t, "1234567890123456", itsi)
+}
+
+func TestParseLazyTextSDU(t *testing.T) {
+	tt := []struct {
+		desc  string
+		bytes []byte
+	}{
+		{desc: "ISO8859-1", bytes: []byte{0x01, 0x74, 0x65, 0x73, 0x74, 0xE4}},
+		{desc: "with timestamp", bytes: []byte{0x81, 0x04, 0x5A, 0x8F, 0x74, 0x65, 0x73, 0x74}},
+		{desc: "UTF16BE", bytes: []byte{0x1A, 0x04, 0x42, 0x04, 0x35}},
+		{desc: "packed 7-bit", bytes: []byte{0x00, 0xE9, 0x97, 0x9F, 0x4D, 0x3B, 0xB3, 0x80}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			eager, err := ParseTextSDU(tc.bytes)
+			assert.NoError(t, err)
+
+			lazy, err := ParseLazyTextSDU(tc.bytes)
+			assert.NoError(t, err)
+			text, err := lazy.DecodeText()
+			assert.NoError(t, err)
+			assert.Equal(t, eager.Text, text)
+
+			decoded, err := lazy.TextSDU()
+			assert.NoError(t, err)
+			assert.Equal(t, eager, decoded)
+		})
+	}
+}
+
+func BenchmarkParseTextSDU(b *testing.B) {
+	bytes := append([]byte{0x81, 0x04, 0x5A, 0x8F}, []byte("this is a longer test message that needs to be decoded")...)
+
+	b.Run("eager", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ParseTextSDU(bytes)
+		}
+	})
+	b.Run("lazy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = ParseLazyTextSDU(bytes)
+		}
+	})
+}
+
+func TestTextHeader_Language(t *testing.T) {
+	header, err := ParseTextHeader([]byte{byte(ISO8859_7)})
+	require.NoError(t, err)
+	assert.Equal(t, "el", header.Language())
+
+	assert.Equal(t, "vi", VISCII.Language())
+	assert.Equal(t, "", ISO8859_1.Language())
+	assert.Equal(t, "", UTF16BE.Language())
+}
@@ -3,7 +3,9 @@ package tetra
 import (
 	"context"
 	"encoding/hex"
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -36,12 +38,119 @@ const (
 	ExtendedTSI
 )
 
+var identityTypeNames = map[IdentityType]string{
+	SSI:         "SSI",
+	TSI:         "TSI",
+	SNA:         "SNA",
+	PABX:        "PABX",
+	PSTN:        "PSTN",
+	ExtendedTSI: "Extended TSI",
+}
+
+// ParseIdentityType parses the numeric identity type as it is reported by the radio, e.g. in the +CTSDSR header.
+func ParseIdentityType(s string) (IdentityType, error) {
+	s = strings.TrimSpace(s)
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid identity type %s: %v", s, err)
+	}
+	if value < 0 || value > int(ExtendedTSI) {
+		return 0, fmt.Errorf("invalid identity type %s: unknown value", s)
+	}
+	return IdentityType(value), nil
+}
+
+func (t IdentityType) String() string {
+	name, ok := identityTypeNames[t]
+	if !ok {
+		return fmt.Sprintf("unknown identity type %d", byte(t))
+	}
+	return name
+}
+
 // TypedIdentity combines an identity with its type in one struct
 type TypedIdentity struct {
 	Identity Identity
 	Type     IdentityType
 }
 
+// ParseGTSI parses the given string as GTSI. The string must either contain only the GSSI with up to 8 digits
+// or the full GTSI with 15 digits: 3 digits MCC, 4 digits MNC, and 8 digits GSSI.
+func ParseGTSI(s string) (GTSI, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return GTSI{}, fmt.Errorf("empty GTSI")
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return GTSI{}, fmt.Errorf("invalid GTSI %s: only digits allowed", s)
+		}
+	}
+
+	var result GTSI
+	var gssi string
+	switch {
+	case len(s) <= 8:
+		gssi = s
+	case len(s) == 15:
+		// the 3 digits MCC and 4 digits MNC always fit into their 10 bits and 14 bits
+		mcc, _ := strconv.Atoi(s[0:3])
+		mnc, _ := strconv.Atoi(s[3:7])
+		result.mcc = uint16(mcc)
+		result.mnc = uint16(mnc)
+		result.withNetwork = true
+		gssi = s[7:]
+	default:
+		return GTSI{}, fmt.Errorf("invalid GTSI %s: wrong length %d", s, len(s))
+	}
+
+	value, _ := strconv.Atoi(gssi)
+	if value > maxSSI {
+		return GTSI{}, fmt.Errorf("invalid GTSI %s: GSSI out of range", s)
+	}
+	result.gssi = uint32(value)
+
+	return result, nil
+}
+
+const maxSSI = 16777215
+
+// GTSI represents a group TETRA subscriber identity, see [AI] 7.2.3
+type GTSI struct {
+	mcc         uint16
+	mnc         uint16
+	gssi        uint32
+	withNetwork bool
+}
+
+// MCC returns the mobile country code of this GTSI, or 0 if the GTSI contains only the GSSI.
+func (g GTSI) MCC() uint16 {
+	return g.mcc
+}
+
+// MNC returns the mobile network code of this GTSI, or 0 if the GTSI contains only the GSSI.
+func (g GTSI) MNC() uint16 {
+	return g.mnc
+}
+
+// GSSI returns the group short subscriber identity of this GTSI.
+func (g GTSI) GSSI() uint32 {
+	return g.gssi
+}
+
+// WithNetwork indicates if this GTSI contains the MCC and MNC.
+func (g GTSI) WithNetwork() bool {
+	return g.withNetwork
+}
+
+// String returns the representation of this GTSI used along the PEI.
+func (g GTSI) String() string {
+	if !g.withNetwork {
+		return strconv.Itoa(int(g.gssi))
+	}
+	return fmt.Sprintf("%03d%04d%08d", g.mcc, g.mnc, g.gssi)
+}
+
 var hexSanitizer = regexp.MustCompile(`\s+`)
 
 // HexToBinary converts the hex representation used along the PEI for binary data into a slice of bytes
@@ -50,6 +159,52 @@ func HexToBinary(s string) ([]byte, error) {
 	return hex.DecodeString(sanitized)
 }
 
+// HexToBinaryInto works like HexToBinary, but decodes into the given buffer without allocating. It returns
+// the number of bytes written to dst. Whitespace between the hex digits is skipped.
+func HexToBinaryInto(dst []byte, s string) (int, error) {
+	n := 0
+	var high byte
+	highPending := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case ' ', '\t', '\n', '\f', '\r':
+			continue
+		}
+		nibble, ok := fromHexChar(c)
+		if !ok {
+			return n, hex.InvalidByteError(c)
+		}
+		if !highPending {
+			high = nibble
+			highPending = true
+			continue
+		}
+		if n >= len(dst) {
+			return n, fmt.Errorf("buffer too small for hex data: %d bytes", len(dst))
+		}
+		dst[n] = high<<4 | nibble
+		n++
+		highPending = false
+	}
+	if highPending {
+		return n, hex.ErrLength
+	}
+	return n, nil
+}
+
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
 // BinaryToHex converts a slice of bytes into the hex representation used along the PEI for binary data
 func BinaryToHex(pdu []byte) string {
 	return strings.ToUpper(hex.EncodeToString(pdu))
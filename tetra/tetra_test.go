@@ -15,3 +15,130 @@ func TestHexBinaryRoundtrip(t *testing.T) {
 	actual := BinaryToHex(pdu)
 	assert.Equal(t, hex, actual)
 }
+
+func TestHexToBinaryInto(t *testing.T) {
+	tt := []struct {
+		desc    string
+		value   string
+		invalid bool
+	}{
+		{desc: "plain", value: "82000201546573746E6163687269636874"},
+		{desc: "lower case", value: "82000201546573746e6163687269636874"},
+		{desc: "whitespace", value: " 820002\r\n0154657374\t6E6163687269636874 \n"},
+		{desc: "empty", value: ""},
+		{desc: "odd length", value: "820", invalid: true},
+		{desc: "invalid character", value: "82X0", invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.desc, func(t *testing.T) {
+			expected, expectedErr := HexToBinary(tc.value)
+
+			buffer := make([]byte, 64)
+			n, err := HexToBinaryInto(buffer, tc.value)
+			if tc.invalid {
+				assert.Error(t, expectedErr)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, expectedErr)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, buffer[:n])
+			}
+		})
+	}
+}
+
+func TestHexToBinaryInto_BufferTooSmall(t *testing.T) {
+	_, err := HexToBinaryInto(make([]byte, 2), "820002")
+	assert.Error(t, err)
+}
+
+func BenchmarkHexToBinary(b *testing.B) {
+	s := "8200C9018D045A8F050003C902017465737420746573742074657374207465737420746573742074657374\r\n"
+
+	b.Run("HexToBinary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = HexToBinary(s)
+		}
+	})
+	b.Run("HexToBinaryInto", func(b *testing.B) {
+		b.ReportAllocs()
+		buffer := make([]byte, len(s)/2)
+		for i := 0; i < b.N; i++ {
+			_, _ = HexToBinaryInto(buffer, s)
+		}
+	})
+}
+
+func TestParseIdentityType(t *testing.T) {
+	tt := []struct {
+		value    string
+		expected IdentityType
+		name     string
+		invalid  bool
+	}{
+		{value: "0", expected: SSI, name: "SSI"},
+		{value: "1", expected: TSI, name: "TSI"},
+		{value: "2", expected: SNA, name: "SNA"},
+		{value: "3", expected: PABX, name: "PABX"},
+		{value: "4", expected: PSTN, name: "PSTN"},
+		{value: " 5 ", expected: ExtendedTSI, name: "Extended TSI"},
+		{value: "6", invalid: true},
+		{value: "-1", invalid: true},
+		{value: "", invalid: true},
+		{value: "a", invalid: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			actual, err := ParseIdentityType(tc.value)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.name, actual.String())
+		})
+	}
+}
+
+func TestIdentityType_String_Unknown(t *testing.T) {
+	assert.Equal(t, "unknown identity type 6", IdentityType(6).String())
+}
+
+func TestParseGTSI(t *testing.T) {
+	tt := []struct {
+		value    string
+		mcc      uint16
+		mnc      uint16
+		gssi     uint32
+		expected string
+		invalid  bool
+	}{
+		{value: "", invalid: true},
+		{value: "12a4", invalid: true},
+		{value: "123456789", invalid: true},
+		{value: "1234567123412345", invalid: true},
+		{value: "102516384000001", invalid: true},
+		{value: "102316383999999999", invalid: true},
+		{value: "99999999", invalid: true},
+		{value: "1234", gssi: 1234, expected: "1234"},
+		{value: " 16777215 ", gssi: 16777215, expected: "16777215"},
+		{value: "123456712341234", mcc: 123, mnc: 4567, gssi: 12341234, expected: "123456712341234"},
+		{value: "262100100000001", mcc: 262, mnc: 1001, gssi: 1, expected: "262100100000001"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			actual, err := ParseGTSI(tc.value)
+			if tc.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.mcc, actual.MCC())
+			assert.Equal(t, tc.mnc, actual.MNC())
+			assert.Equal(t, tc.gssi, actual.GSSI())
+			assert.Equal(t, tc.expected, actual.String())
+		})
+	}
+}